@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasmcloud/secrets/reveal"
+	secretstore "github.com/jamesstocktonj1/mulib/component/composer/gen/wasmcloud/secrets/store"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
+	"github.com/jamesstocktonj1/mulib/pkg/jwt"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+// Every request must present either a bearer token in the Authorization
+// header or an API key in the X-API-Key header.
+//
+// Bearer tokens are JWTs issued by the organisation's identity provider and
+// are verified offline against the JSON Web Key Set in the "jwt-jwks" secret,
+// or the "jwt-jwks" config value if there is no such secret. HS256, RS256 and
+// EdDSA signatures are accepted. A token must not have expired, and must be
+// issued by "jwt-issuer" for "jwt-audience" when they are configured. The
+// values of its roles, scope and scp claims are taken as its roles.
+//
+// API keys are checked against the keyring in the "api-keys" secret, which
+// holds only their SHA-256 hashes, e.g.
+//
+//	[{"id": "importer", "hash": "9f86d0...", "scopes": ["write"], "roles": ["editor"]}]
+//
+// Roles are granted rules by the access policy in the "auth-policy" config
+// value, some of which may only allow some fields to be changed, e.g.
+//
+//	{"roles": {
+//		"editor": ["*:read", "composers:create", {"permission": "composers:update", "fields": ["firstname", "lastname"]}],
+//		"curator": ["*:*"]
+//	}}
+//
+// A role the policy doesn't define grants nothing, even one named like a scope
+// or a permission, so a token scope only grants what a role of that name does.
+//
+// A request without credentials is made by an anonymous principal holding the
+// "anonymous" role, so the policy can open reads to everyone, e.g.
+//
+//	"anonymous": ["composers:read"]
+//
+// Without such a rule, those requests are refused with 401.
+//
+// Every request needs a permission on the resource named by the first segment
+// of its path: reads need read, and writes need create, update or delete. The
+// admin endpoints, the trash purge and webhook management need admin. Writes
+// are also checked against the fields they change. A request without valid
+// credentials is refused with 401, and one lacking the permission with 403. If
+// the key material can't be read every request is refused.
+const (
+	apiKeyHeader  = "X-API-Key"
+	secretAPIKeys = "api-keys"
+
+	bearerPrefix      = "Bearer "
+	secretJWKS        = "jwt-jwks"
+	configJWKS        = "jwt-jwks"
+	configJWTIssuer   = "jwt-issuer"
+	configJWTAudience = "jwt-audience"
+	configJWTLeeway   = "jwt-leeway"
+	configAuthPolicy  = "auth-policy"
+
+	composersResource = "composers"
+
+	anonymousRole = "anonymous"
+
+	defaultJWTLeeway = time.Minute
+
+	authChallenge = `Bearer realm="mulib", ApiKey realm="mulib"`
+)
+
+// secretError wraps a wasmcloud:secrets error so it can be returned as a Go
+// error.
+type secretError struct {
+	op  string
+	err secretstore.SecretsError
+}
+
+func newSecretError(op string, err *secretstore.SecretsError) error {
+	return &secretError{op: op, err: *err}
+}
+
+func (e *secretError) Error() string {
+	switch {
+	case e.err.NotFound():
+		return e.op + ": not found"
+	case e.err.Upstream() != nil:
+		return e.op + ": " + *e.err.Upstream()
+	case e.err.IO() != nil:
+		return e.op + ": " + *e.err.IO()
+	default:
+		return e.op
+	}
+}
+
+// revealSecret returns the value of the named secret.
+func revealSecret(name string) ([]byte, error) {
+	res := secretstore.Get(name)
+	if res.IsErr() {
+		return nil, newSecretError("error getting secret "+name, res.Err())
+	}
+	secret := *res.OK()
+	defer secret.ResourceDrop()
+
+	value := reveal.Reveal(secret)
+	if s := value.String(); s != nil {
+		return []byte(*s), nil
+	}
+	return value.Bytes().Slice(), nil
+}
+
+// authenticate returns the principal of the credentials presented with r,
+// granted the rules of its roles under the access policy.
+func authenticate(r *http.Request) (auth.Principal, error) {
+	policy, err := accessPolicy()
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	p, err := authenticateCredentials(r)
+	if err != nil {
+		return p, err
+	}
+	p.Rules = append(p.Rules, policy.Rules(p.Roles)...)
+	return p, nil
+}
+
+// authenticateCredentials returns the principal of the bearer token or API
+// key presented with r, or the anonymous principal if it presents neither.
+func authenticateCredentials(r *http.Request) (auth.Principal, error) {
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		token, ok := strings.CutPrefix(authz, bearerPrefix)
+		if !ok {
+			return auth.Principal{}, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "unsupported authorization scheme")
+		}
+		return authenticateToken(strings.TrimSpace(token))
+	}
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return authenticateKey(key)
+	}
+	return anonymousPrincipal(), nil
+}
+
+// anonymousPrincipal returns the principal of a request without credentials.
+func anonymousPrincipal() auth.Principal {
+	return auth.Principal{Subject: anonymousRole, Method: auth.MethodAnonymous, Roles: []string{anonymousRole}}
+}
+
+// publicRead reports whether the access policy lets anyone read resource,
+// without credentials.
+func publicRead(resource string) bool {
+	policy, err := accessPolicy()
+	if err != nil {
+		return false
+	}
+	p := anonymousPrincipal()
+	p.Rules = policy.Rules(p.Roles)
+	return p.Can(resource, auth.ActionRead)
+}
+
+// authenticateKey returns the principal of the presented API key.
+func authenticateKey(presented string) (auth.Principal, error) {
+	keyringBytes, err := revealSecret(secretAPIKeys)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	keyring, err := auth.ParseKeyring(keyringBytes)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	p, ok := keyring.Authenticate(presented)
+	if !ok {
+		return auth.Principal{}, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid API key")
+	}
+	return p, nil
+}
+
+// authenticateToken returns the principal of the presented bearer token.
+func authenticateToken(token string) (auth.Principal, error) {
+	verifier, err := tokenVerifier()
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	claims, err := verifier.Verify(token, now())
+	if err != nil {
+		return auth.Principal{}, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid token: "+err.Error())
+	}
+
+	p := auth.Principal{
+		Subject: claims.Subject,
+		Method:  auth.MethodJWT,
+		Roles:   slices.Concat(claims.Roles, claims.Scope, claims.Scp),
+	}
+	return p, nil
+}
+
+// tokenVerifier returns a verifier for the configured key set, issuer and
+// audience.
+func tokenVerifier() (jwt.Verifier, error) {
+	jwksBytes, err := revealSecret(secretJWKS)
+	var secretErr *secretError
+	if errors.As(err, &secretErr) && secretErr.err.NotFound() {
+		jwksBytes, err = []byte(configValue(configJWKS, "")), nil
+	}
+	if err != nil {
+		return jwt.Verifier{}, err
+	} else if len(jwksBytes) == 0 {
+		return jwt.Verifier{}, errors.New("no JSON Web Key Set configured")
+	}
+
+	keys, err := jwt.ParseJWKS(jwksBytes)
+	if err != nil {
+		return jwt.Verifier{}, err
+	}
+
+	verifier := jwt.Verifier{
+		Keys:     keys,
+		Issuer:   configValue(configJWTIssuer, ""),
+		Audience: configValue(configJWTAudience, ""),
+		Leeway:   configDuration(configJWTLeeway, defaultJWTLeeway),
+	}
+	return verifier, nil
+}
+
+// accessPolicy returns the configured access policy. Without one, roles grant
+// nothing.
+func accessPolicy() (auth.Policy, error) {
+	value := configValue(configAuthPolicy, "")
+	if value == "" {
+		return auth.Policy{}, nil
+	}
+	return auth.ParsePolicy([]byte(value))
+}
+
+// principal returns the principal making r.
+func principal(r *http.Request) auth.Principal {
+	p, _ := auth.PrincipalFrom(r.Context())
+	return p
+}
+
+// requiredPermission returns the permission needed to make the request, as
+// the resource it acts on and the action it takes.
+func requiredPermission(r *http.Request) (string, auth.Action) {
+	path := r.URL.Path
+
+	// Resource is the first path segment, less any custom method
+	resource, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	resource, method, _ := strings.Cut(resource, ":")
+	if method == "" {
+		_, method, _ = strings.Cut(path[strings.LastIndex(path, "/")+1:], ":")
+	}
+	if resource == "catalogue" {
+		resource = "works"
+	}
+
+	switch {
+	case resource == "admin", resource == "webhooks", method == "purge":
+		return resource, auth.ActionAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return resource, auth.ActionRead
+	case method == "import":
+		return resource, auth.ActionCreate
+	case method == "restore" || method == "revert":
+		return resource, auth.ActionUpdate
+	case r.Method == http.MethodPost:
+		return resource, auth.ActionCreate
+	case r.Method == http.MethodDelete:
+		return resource, auth.ActionDelete
+	default:
+		return resource, auth.ActionUpdate
+	}
+}
+
+// authorize authenticates r and checks that its principal may make it,
+// writing the error response if not. It returns r carrying the principal.
+func authorize(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	// Authenticate request
+	p, err := authenticate(r)
+	if err != nil {
+		logger.Error("Error authenticating request", "error", err)
+		prob := errorProblem(err)
+		if prob.Status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", authChallenge)
+		}
+		writeError(w, r, prob)
+		return r, false
+	}
+
+	// Check permission
+	resource, action := requiredPermission(r)
+	err = p.Check(resource, action, nil)
+	if err != nil && p.Method == auth.MethodAnonymous {
+		logger.Error("Anonymous request lacks permission", "error", err)
+		w.Header().Set("WWW-Authenticate", authChallenge)
+		writeProblem(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "missing credentials")
+		return r, false
+	} else if err != nil {
+		logger.Error("Principal lacks permission", "subject", p.Subject, "error", err)
+		writeError(w, r, err)
+		return r, false
+	}
+
+	return r.WithContext(auth.WithPrincipal(r.Context(), p)), true
+}
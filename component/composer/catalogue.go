@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/catalogue"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+func catalogueIndexKey(num catalogue.Number) string {
+	return indexKey("catalogue", num.String())
+}
+
+func catalogueHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Looking up catalogue number")
+
+	// Get catalogue number
+	num, err := catalogue.Parse(r.PathValue("scheme") + " " + r.PathValue("number"))
+	if err != nil {
+		logger.Error("Invalid catalogue number", "scheme", r.PathValue("scheme"), "number", r.PathValue("number"))
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid catalogue number")
+		return
+	}
+
+	// Get page size
+	limit := defaultPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxPageSize {
+			logger.Error("Invalid limit query", "limit", l)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid limit query")
+			return
+		}
+		limit = n
+	}
+
+	// Get cursor
+	cur, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		logger.Error("Invalid cursor query", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid cursor query")
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Read index
+	ids, err := readIndex(*bucket, catalogueIndexKey(num))
+	if err != nil {
+		logger.Error("Error reading index", "number", num.String(), "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Read works
+	page, err := sortedWorksPage(*bucket, ids, cur, limit)
+	if err != nil {
+		logger.Error("Error listing works", "error", err)
+		writeError(w, r, err)
+		return
+	} else if len(page.Works) == 0 {
+		logger.Error("No work has catalogue number", "number", num.String())
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "no work has catalogue number "+num.String())
+		return
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, page)
+}
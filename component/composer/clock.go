@@ -0,0 +1,13 @@
+package main
+
+import (
+	"time"
+
+	wallclock "github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/clocks/wall-clock"
+)
+
+// now returns the current time read from wasi:clocks/wall-clock.
+func now() time.Time {
+	dt := wallclock.Now()
+	return time.Unix(int64(dt.Seconds), int64(dt.Nanoseconds)).UTC()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasmcloud/messaging/consumer"
+	msghandler "github.com/jamesstocktonj1/mulib/component/composer/gen/wasmcloud/messaging/handler"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasmcloud/messaging/types"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+// Composers can also be created, updated and deleted by command messages, for
+// systems which can publish messages but not make HTTP calls. The messaging
+// link subscribes the component to the command subjects, and each command goes
+// through the same permission checks, validation and persistence as its HTTP
+// endpoint. When the message has a reply-to subject the outcome is published
+// to it as a composer.CommandReply.
+//
+// Messages carry no credentials, so every command is made by one principal,
+// granted the rules of the roles listed in the "command-roles" config value,
+// e.g. "editor,importer", by the access policy. With no roles configured every
+// command is refused.
+const (
+	configCommandRoles = "command-roles"
+
+	// commandActor is the subject of the command principal, and is recorded
+	// in the history of every command.
+	commandActor = "messaging"
+)
+
+func init() {
+	msghandler.Exports.HandleMessage = messageHandler
+}
+
+func messageHandler(msg types.BrokerMessage) cm.Result[string, struct{}, string] {
+	logger.Info("Handling message", "subject", msg.Subject)
+
+	// Handle command
+	cmd := composer.Command{}
+	reply := composer.CommandReply{}
+	err := json.Unmarshal(msg.Body.Slice(), &cmd)
+	if err != nil {
+		err = problem.New(http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
+	} else {
+		reply.Command = cmd.Command
+		reply.ID = cmd.ID
+		var comp composer.Composer
+		comp, err = runCommand(cmd)
+		if err == nil {
+			reply.ID = comp.ID
+			reply.Composer = &comp
+		}
+	}
+	if err != nil {
+		logger.Error("Error handling command", "subject", msg.Subject, "command", cmd.Command, "id", cmd.ID, "error", err)
+		reply.Error = errorProblem(err)
+	}
+
+	// Write reply
+	if replyTo := msg.ReplyTo.Some(); replyTo != nil {
+		publishReply(*replyTo, reply)
+	}
+
+	if err != nil {
+		return cm.Err[cm.Result[string, struct{}, string]](err.Error())
+	}
+	return cm.OK[cm.Result[string, struct{}, string]](struct{}{})
+}
+
+// runCommand validates cmd and applies it to the composer it names, returning
+// the composer as stored.
+func runCommand(cmd composer.Command) (composer.Composer, error) {
+	// Validate command
+	err := cmd.Validate()
+	if err != nil {
+		return composer.Composer{}, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error())
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		return composer.Composer{}, newStoreError("error opening bucket", bucketRes.Err())
+	}
+	bucket := bucketRes.OK()
+
+	// Get principal
+	p, err := commandPrincipal()
+	if err != nil {
+		return composer.Composer{}, err
+	}
+
+	match := func(tag string) bool {
+		return cmd.Revision == 0 || tag == revisionTag(cmd.Revision)
+	}
+
+	switch cmd.Command {
+	case composer.CommandCreate:
+		return createComposer(*bucket, p.Subject, p, *cmd.Composer)
+	case composer.CommandUpdate:
+		return updateComposer(*bucket, p.Subject, p, cmd.ID, match, *cmd.Composer)
+	default:
+		return deleteComposer(*bucket, p.Subject, p, cmd.ID, match)
+	}
+}
+
+// commandPrincipal returns the principal which makes every command, with the
+// rules the access policy grants the configured command roles.
+func commandPrincipal() (auth.Principal, error) {
+	policy, err := accessPolicy()
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	roles := []string{}
+	for _, role := range strings.Split(configValue(configCommandRoles, ""), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return auth.Principal{
+		Subject: commandActor,
+		Method:  commandActor,
+		Roles:   roles,
+		Rules:   policy.Rules(roles),
+	}, nil
+}
+
+// publishReply publishes reply to the reply-to subject of a command.
+func publishReply(subject string, reply composer.CommandReply) {
+	replyBytes, err := json.Marshal(reply)
+	if err != nil {
+		logger.Error("Error encoding reply", "subject", subject, "error", err)
+		return
+	}
+
+	msg := types.BrokerMessage{
+		Subject: subject,
+		Body:    cm.ToList(replyBytes),
+		ReplyTo: cm.None[string](),
+	}
+	res := consumer.Publish(msg)
+	if res.IsErr() {
+		logger.Error("Error publishing reply", "subject", subject, "error", *res.Err())
+	}
+}
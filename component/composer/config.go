@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/config/runtime"
+)
+
+const (
+	configPathPrefix         = "path-prefix"
+	configTrashRetention     = "trash-retention"
+	configPurgeInterval      = "purge-interval"
+	configWebhookMaxAttempts = "webhook-max-attempts"
+	configWebhookBackoff     = "webhook-backoff"
+	configWebhookBackoffMax  = "webhook-backoff-max"
+	configWebhookTimeout     = "webhook-timeout"
+	configWebhookRetryBudget = "webhook-retry-budget"
+
+	defaultTrashRetention     = 30 * 24 * time.Hour
+	defaultPurgeInterval      = 24 * time.Hour
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookBackoff     = 30 * time.Second
+	defaultWebhookBackoffMax  = time.Hour
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookRetryBudget = 30 * time.Second
+)
+
+// configValue returns the runtime config value for key, or fallback when it is
+// unset or the config can't be read.
+func configValue(key, fallback string) string {
+	res := runtime.Get(key)
+	if res.IsErr() {
+		logger.Error("Error getting config", "key", key, "error", res.Err())
+		return fallback
+	}
+	value := res.OK().Some()
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
+// configDuration returns the runtime config value for key parsed as a
+// duration, or fallback when it is unset or invalid.
+func configDuration(key string, fallback time.Duration) time.Duration {
+	value := configValue(key, "")
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Error("Invalid duration config", "key", key, "value", value, "error", err)
+		return fallback
+	}
+	return d
+}
+
+// configInt returns the runtime config value for key parsed as an integer, or
+// fallback when it is unset or invalid.
+func configInt(key string, fallback int) int {
+	value := configValue(key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Error("Invalid integer config", "key", key, "value", value, "error", err)
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/atomics"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/batch"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/cloudevents"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+	"github.com/jamesstocktonj1/mulib/pkg/webhook"
+)
+
+// Every event is posted, as the same structured CloudEvent that is published
+// over messaging, to each subscription whose filter matches it. The first
+// attempt is made as soon as the event has been published. A delivery which
+// fails is queued under "webhook-delivery:<subscription id>:<delivery id>" and
+// retried with exponential backoff by the retry endpoint, which makes as many
+// attempts as fit in webhook-retry-budget each time it is called. A delivery
+// which has failed webhook-max-attempts times becomes a dead letter under
+// "webhook-dead:<subscription id>:<delivery id>" until it is redelivered or
+// the subscription is deleted.
+//
+// Every attempt is recorded in the delivery log of its subscription under
+// "webhook-log:<subscription id>:<n>", where n is taken from an atomic counter
+// kept under "webhook-log:<subscription id>", so that attempts made at once
+// never overwrite each other. The log keeps the most recent attempts, each
+// new one deleting the attempt maxDeliveryLog before it.
+const (
+	deliveryPrefix    = "webhook-delivery:"
+	deadLetterPrefix  = "webhook-dead:"
+	deliveryLogPrefix = "webhook-log:"
+
+	maxDeliveryLog = 100
+)
+
+func deliveryKey(prefix, subID, id string) string {
+	return prefix + subID + ":" + id
+}
+
+func deliveryLogKey(subID string) string {
+	return deliveryLogPrefix + subID
+}
+
+func attemptKey(subID string, n uint64) string {
+	return deliveryLogKey(subID) + ":" + strconv.FormatUint(n, 10)
+}
+
+// deliverWebhooks makes the first attempt at delivering the event to every
+// subscription which matches it.
+func deliverWebhooks(bucket store.Bucket, event cloudevents.Event, body []byte) {
+	subs, err := listWebhooks(bucket)
+	if err != nil {
+		logger.Error("Error listing webhooks", "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if !sub.Matches(event.Type) {
+			continue
+		}
+		d := webhook.Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Status:         webhook.StatusPending,
+			CreatedAt:      now(),
+			Payload:        body,
+		}
+		_, err = attemptDelivery(bucket, sub, d)
+		if err != nil {
+			logger.Error("Error storing delivery", "webhook", sub.ID, "delivery", d.ID, "error", err)
+		}
+	}
+}
+
+// attemptDelivery makes the next attempt at d and records it in the delivery
+// log. A delivery which fails is stored to be retried, or as a dead letter once
+// it has no attempts left. It returns the delivery as updated by the attempt.
+func attemptDelivery(bucket store.Bucket, sub webhook.Subscription, d webhook.Delivery) (webhook.Delivery, error) {
+	d.Attempts++
+	attemptedAt := now()
+
+	// Post payload
+	header := http.Header{}
+	header.Set("Content-Type", cloudevents.ContentType)
+	header.Set(webhook.SignatureHeader, webhook.Sign(sub.Secret, attemptedAt, d.Payload))
+	header.Set(webhook.DeliveryHeader, d.ID)
+	header.Set(webhook.EventHeader, d.EventType)
+
+	// Check the subscription again, as it may have been stored before its host
+	// would be refused
+	status := 0
+	err := sub.Validate()
+	if err == nil {
+		status, err = post(sub.URL, header, d.Payload, configDuration(configWebhookTimeout, defaultWebhookTimeout))
+	}
+	if err == nil && !webhook.Succeeded(status) {
+		err = fmt.Errorf("unexpected status %d", status)
+	}
+
+	// Store outcome
+	pendingKey := deliveryKey(deliveryPrefix, sub.ID, d.ID)
+	var storeErr error
+	switch {
+	case err == nil:
+		d.Status = webhook.StatusDelivered
+		d.NextAttemptAt = nil
+		d.LastError = ""
+		storeErr = deleteDelivery(bucket, pendingKey)
+	case d.Attempts >= configInt(configWebhookMaxAttempts, defaultWebhookMaxAttempts):
+		logger.Error("Webhook delivery failed", "webhook", sub.ID, "delivery", d.ID, "attempts", d.Attempts, "error", err)
+		d.Status = webhook.StatusDead
+		d.NextAttemptAt = nil
+		d.LastError = err.Error()
+		storeErr = putDelivery(bucket, deliveryKey(deadLetterPrefix, sub.ID, d.ID), d)
+		if storeErr == nil {
+			storeErr = deleteDelivery(bucket, pendingKey)
+		}
+	default:
+		logger.Error("Webhook delivery failed", "webhook", sub.ID, "delivery", d.ID, "attempts", d.Attempts, "error", err)
+		wait := webhook.Backoff(d.Attempts,
+			configDuration(configWebhookBackoff, defaultWebhookBackoff),
+			configDuration(configWebhookBackoffMax, defaultWebhookBackoffMax))
+		next := attemptedAt.Add(wait)
+		d.Status = webhook.StatusPending
+		d.NextAttemptAt = &next
+		d.LastError = err.Error()
+		storeErr = putDelivery(bucket, pendingKey, d)
+	}
+
+	// Record attempt
+	attempt := webhook.Attempt{
+		DeliveryID:  d.ID,
+		EventID:     d.EventID,
+		EventType:   d.EventType,
+		Attempt:     d.Attempts,
+		AttemptedAt: attemptedAt,
+		StatusCode:  status,
+		Error:       d.LastError,
+		Status:      d.Status,
+	}
+	logErr := appendDeliveryLog(bucket, sub.ID, attempt)
+	if logErr != nil {
+		logger.Error("Error recording delivery", "webhook", sub.ID, "delivery", d.ID, "error", logErr)
+	}
+	return d, storeErr
+}
+
+func retryWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Retrying webhook deliveries")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// List deliveries
+	keys, err := keysWithPrefix(*bucket, deliveryPrefix)
+	if err != nil {
+		logger.Error("Error listing keys", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Retry deliveries which are due, while an attempt still fits in the budget
+	counts := map[string]int{}
+	attempted, more := 0, false
+	deadline := now().Add(configDuration(configWebhookRetryBudget, defaultWebhookRetryBudget))
+	timeout := configDuration(configWebhookTimeout, defaultWebhookTimeout)
+	subs := map[string]*webhook.Subscription{}
+	for _, key := range keys {
+		if now().Add(timeout).After(deadline) {
+			more = true
+			break
+		}
+
+		d, ok, err := getDelivery(*bucket, key)
+		if err != nil {
+			logger.Error("Error reading value", "key", key, "error", err)
+			writeError(w, r, err)
+			return
+		} else if !ok || (d.NextAttemptAt != nil && d.NextAttemptAt.After(now())) {
+			continue
+		}
+
+		sub, seen := subs[d.SubscriptionID]
+		if !seen {
+			s, ok, err := getWebhook(*bucket, d.SubscriptionID)
+			if err != nil {
+				logger.Error("Error getting value", "error", err)
+				writeError(w, r, err)
+				return
+			} else if ok {
+				sub = &s
+			}
+			subs[d.SubscriptionID] = sub
+		}
+		if sub == nil {
+			err = deleteDelivery(*bucket, key)
+			if err != nil {
+				logger.Error("Error deleting delivery", "key", key, "error", err)
+			}
+			continue
+		} else if sub.Disabled {
+			continue
+		}
+
+		d, err = attemptDelivery(*bucket, *sub, d)
+		if err != nil {
+			logger.Error("Error storing delivery", "key", key, "error", err)
+		}
+		attempted++
+		counts[d.Status]++
+	}
+
+	// Write response
+	retryResponse := map[string]any{
+		"attempted": attempted,
+		"delivered": counts[webhook.StatusDelivered],
+		"pending":   counts[webhook.StatusPending],
+		"dead":      counts[webhook.StatusDead],
+		"more":      more,
+		"message":   "webhook deliveries retried",
+	}
+	writeJSON(w, http.StatusOK, retryResponse)
+}
+
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing webhook deliveries")
+
+	// Get webhook ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Check value exists
+	_, ok, err := getWebhook(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "webhook does not exist")
+		return
+	}
+
+	// Read log
+	attempts, err := readDeliveryLog(*bucket, id)
+	if err != nil {
+		logger.Error("Error reading delivery log", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Read pending deliveries
+	pending, err := listDeliveries(*bucket, deliveryPrefix+id+":")
+	if err != nil {
+		logger.Error("Error listing deliveries", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	deliveriesResponse := map[string]any{
+		"attempts": attempts,
+		"pending":  pending,
+	}
+	writeJSON(w, http.StatusOK, deliveriesResponse)
+}
+
+func deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing webhook dead letters")
+
+	// Get webhook ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Check value exists
+	_, ok, err := getWebhook(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "webhook does not exist")
+		return
+	}
+
+	// Read dead letters
+	dead, err := listDeliveries(*bucket, deadLetterPrefix+id+":")
+	if err != nil {
+		logger.Error("Error listing dead letters", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	deadLettersResponse := map[string]any{
+		"deadLetters": dead,
+	}
+	writeJSON(w, http.StatusOK, deadLettersResponse)
+}
+
+func redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Redelivering webhook dead letter")
+
+	// Get webhook and delivery IDs
+	id := r.PathValue("id")
+	deliveryID := r.PathValue("delivery")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get webhook
+	sub, ok, err := getWebhook(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "webhook does not exist")
+		return
+	}
+
+	// Get dead letter
+	deadKey := deliveryKey(deadLetterPrefix, id, deliveryID)
+	d, ok, err := getDelivery(*bucket, deadKey)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id, "delivery", deliveryID)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "dead letter does not exist")
+		return
+	}
+
+	// Remove dead letter
+	err = deleteDelivery(*bucket, deadKey)
+	if err != nil {
+		logger.Error("Error deleting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Attempt delivery with a fresh set of attempts
+	d.Attempts = 0
+	d.Status = webhook.StatusPending
+	d, err = attemptDelivery(*bucket, sub, d)
+	if err != nil {
+		logger.Error("Error storing delivery", "delivery", d.ID, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, d)
+}
+
+func getDelivery(bucket store.Bucket, key string) (webhook.Delivery, bool, error) {
+	d := webhook.Delivery{}
+
+	res := bucket.Get(key)
+	if res.IsErr() {
+		return d, false, newStoreError("error getting value", res.Err())
+	}
+	value := res.OK().Some()
+	if value == nil {
+		return d, false, nil
+	}
+
+	err := json.Unmarshal(value.Slice(), &d)
+	if err != nil {
+		return d, false, err
+	}
+	return d, true, nil
+}
+
+func putDelivery(bucket store.Bucket, key string, d webhook.Delivery) error {
+	dBytes, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	res := bucket.Set(key, cm.ToList(dBytes))
+	if res.IsErr() {
+		return newStoreError("error setting value", res.Err())
+	}
+	return nil
+}
+
+func deleteDelivery(bucket store.Bucket, key string) error {
+	res := bucket.Delete(key)
+	if res.IsErr() {
+		return newStoreError("error deleting value", res.Err())
+	}
+	return nil
+}
+
+// listDeliveries returns every delivery stored under a key with the prefix.
+func listDeliveries(bucket store.Bucket, prefix string) ([]webhook.Delivery, error) {
+	keys, err := keysWithPrefix(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []webhook.Delivery{}
+	for _, key := range keys {
+		d, ok, err := getDelivery(bucket, key)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// deleteDeliveries deletes the pending deliveries, dead letters and delivery
+// log of a subscription.
+func deleteDeliveries(bucket store.Bucket, subID string) error {
+	keys, err := allKeys(bucket)
+	if err != nil {
+		return err
+	}
+
+	deleted := []string{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, deliveryPrefix+subID+":") ||
+			strings.HasPrefix(key, deadLetterPrefix+subID+":") ||
+			strings.HasPrefix(key, deliveryLogKey(subID)+":") ||
+			key == deliveryLogKey(subID) {
+			deleted = append(deleted, key)
+		}
+	}
+	for start := 0; start < len(deleted); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(deleted))
+		res := batch.DeleteMany(bucket, cm.ToList(deleted[start:end]))
+		if res.IsErr() {
+			return newStoreError("error deleting values", res.Err())
+		}
+	}
+	return nil
+}
+
+// readDeliveryLog returns the recorded attempts of a subscription, newest
+// first.
+func readDeliveryLog(bucket store.Bucket, subID string) ([]webhook.Attempt, error) {
+	attempts := []webhook.Attempt{}
+
+	// Get attempt count
+	countRes := atomics.Increment(bucket, deliveryLogKey(subID), 0)
+	if countRes.IsErr() {
+		return attempts, newStoreError("error getting attempt count", countRes.Err())
+	}
+	count := *countRes.OK()
+	if count == 0 {
+		return attempts, nil
+	}
+
+	// Get the most recent attempts
+	keys := []string{}
+	for n := count; n > 0 && count-n < maxDeliveryLog; n-- {
+		keys = append(keys, attemptKey(subID, n))
+	}
+	getRes := batch.GetMany(bucket, cm.ToList(keys))
+	if getRes.IsErr() {
+		return attempts, newStoreError("error getting values", getRes.Err())
+	}
+	for _, kv := range getRes.OK().Slice() {
+		some := kv.Some()
+		if some == nil {
+			continue
+		}
+		attempt := webhook.Attempt{}
+		err := json.Unmarshal(some.F1.Slice(), &attempt)
+		if err != nil {
+			return attempts, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+// appendDeliveryLog records an attempt in the delivery log of a subscription,
+// dropping the attempt maxDeliveryLog before it.
+func appendDeliveryLog(bucket store.Bucket, subID string, attempt webhook.Attempt) error {
+	attemptBytes, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+
+	// Take the next attempt number
+	countRes := atomics.Increment(bucket, deliveryLogKey(subID), 1)
+	if countRes.IsErr() {
+		return newStoreError("error incrementing attempt count", countRes.Err())
+	}
+	n := *countRes.OK()
+
+	// Set value
+	res := bucket.Set(attemptKey(subID, n), cm.ToList(attemptBytes))
+	if res.IsErr() {
+		return newStoreError("error setting value", res.Err())
+	}
+
+	// Delete the attempt which has dropped out of the log
+	if n > maxDeliveryLog {
+		res = bucket.Delete(attemptKey(subID, n-maxDeliveryLog))
+		if res.IsErr() {
+			return newStoreError("error deleting value", res.Err())
+		}
+	}
+	return nil
+}
+
+// keysWithPrefix returns every key in the bucket with the prefix.
+func keysWithPrefix(bucket store.Bucket, prefix string) ([]string, error) {
+	keys, err := allKeys(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []string{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			matched = append(matched, key)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/atomics"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/batch"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+)
+
+// Every primary record has data derived from it kept in the same bucket: its
+// entries in the indexes, which include the search tokens of composer names,
+// and its share of the aggregate counts. What was derived from each record is
+// itself stored under "derived:<key>", so that the derived data can be brought
+// up to date from the new value alone, without the value it replaced.
+//
+// The keyvalue watcher is the only maintainer of the derived data. It is
+// called after every write to the bucket, whether made by a handler or by a
+// tool writing to the bucket directly, so a handler doesn't sync its own
+// writes, and a listing may miss a write for as long as the watcher takes to
+// see it. Syncing a record which is already in sync changes nothing, so a
+// write seen twice is only counted once. Two syncs of the same record at once
+// can still race, and the rebuild endpoint recreates all derived data from
+// the primary records.
+//
+// The keyvalue atomics can only increment, so each count is kept as two
+// counters, of the records added to it under "stats:+:<counter>" and of those
+// removed from it under "stats:-:<counter>". Reading the counts walks the key
+// names of the bucket, which is left to the stats and rebuild endpoints.
+const (
+	derivedPrefix = "derived:"
+	statsPrefix   = "stats:"
+)
+
+// derivation is the data derived from one record.
+type derivation struct {
+	// ID is the id the record is listed under in the indexes.
+	ID string `json:"id"`
+
+	Indexes  []string `json:"indexes"`
+	Counters []string `json:"counters"`
+
+	// Entries is the slot of the record's entry under each index key.
+	Entries map[string]uint64 `json:"entries,omitempty"`
+}
+
+// empty reports whether nothing is derived from the record, as for one which
+// has been deleted.
+func (d derivation) empty() bool {
+	return len(d.Indexes) == 0 && len(d.Counters) == 0
+}
+
+// recordChange is a write of the record at key. The value is nil when the
+// record has been deleted.
+type recordChange struct {
+	key   string
+	value []byte
+}
+
+func derivedKey(key string) string {
+	return derivedPrefix + key
+}
+
+// statKey returns the key of the counter of the records added to counter, or
+// of those removed from it.
+func statKey(counter string, removed bool) string {
+	if removed {
+		return statsPrefix + "-:" + counter
+	}
+	return statsPrefix + "+:" + counter
+}
+
+// isRecordKey reports whether key holds a primary record, as opposed to
+// derived data or history.
+func isRecordKey(key string) bool {
+	return isComposerKey(key) ||
+		strings.HasPrefix(key, works.prefix) ||
+		strings.HasPrefix(key, performers.prefix) ||
+		strings.HasPrefix(key, ensembles.prefix) ||
+		strings.HasPrefix(key, recordings.prefix)
+}
+
+// derive returns the data derived from value stored at key. The boolean result
+// is false when key doesn't hold a primary record.
+func derive(key string, value []byte) (derivation, bool, error) {
+	switch {
+	case isComposerKey(key):
+		d, err := deriveComposer(key, value)
+		return d, true, err
+	case strings.HasPrefix(key, works.prefix):
+		d, err := works.derive(key, value)
+		return d, true, err
+	case strings.HasPrefix(key, performers.prefix):
+		d, err := performers.derive(key, value)
+		return d, true, err
+	case strings.HasPrefix(key, ensembles.prefix):
+		d, err := ensembles.derive(key, value)
+		return d, true, err
+	case strings.HasPrefix(key, recordings.prefix):
+		d, err := recordings.derive(key, value)
+		return d, true, err
+	}
+	return derivation{}, false, nil
+}
+
+// deriveComposer counts live composers by era and nationality, and those in
+// the trash on their own.
+func deriveComposer(key string, value []byte) (derivation, error) {
+	d := derivation{ID: key}
+	if value == nil {
+		return d, nil
+	}
+
+	comp := composer.Composer{}
+	err := json.Unmarshal(value, &comp)
+	if err != nil {
+		return d, err
+	}
+
+	d.Indexes = indexKeys(comp)
+	if comp.Deleted() {
+		d.Counters = []string{"composers:deleted"}
+		return d, nil
+	}
+	d.Counters = []string{"composers"}
+	if era := strings.ToLower(strings.TrimSpace(comp.Era)); era != "" {
+		d.Counters = append(d.Counters, "composers:era:"+era)
+	}
+	if nationality := strings.ToLower(strings.TrimSpace(comp.Nationality)); nationality != "" {
+		d.Counters = append(d.Counters, "composers:nationality:"+nationality)
+	}
+	return d, nil
+}
+
+// syncDerived brings the data derived from each changed record up to date,
+// deleting and setting the index entries in batches and writing the counts
+// once however many of the records they cover. Changes to keys which don't
+// hold primary records are ignored. At most one get-many's worth of changes
+// may be synced at once.
+func syncDerived(bucket store.Bucket, changes ...recordChange) error {
+	// Derive data from the new values
+	keys := []string{}
+	next := map[string]derivation{}
+	for _, change := range changes {
+		d, ok, err := derive(change.key, change.value)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		keys = append(keys, change.key)
+		next[change.key] = d
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// Get what was derived before
+	derivedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		derivedKeys[i] = derivedKey(key)
+	}
+	getRes := batch.GetMany(bucket, cm.ToList(derivedKeys))
+	if getRes.IsErr() {
+		return newStoreError("error getting derived values", getRes.Err())
+	}
+	prev := map[string]derivation{}
+	for _, kv := range getRes.OK().Slice() {
+		some := kv.Some()
+		if some == nil {
+			continue
+		}
+		d := derivation{}
+		err := json.Unmarshal(some.F1.Slice(), &d)
+		if err != nil {
+			return err
+		}
+		prev[strings.TrimPrefix(some.F0, derivedPrefix)] = d
+	}
+
+	// Compare derivations, keeping the slots of unchanged index entries
+	added, addedTo := []indexEntry{}, []string{}
+	removed := []string{}
+	deltas := map[string]int64{}
+	for _, key := range keys {
+		before, after := prev[key], next[key]
+		after.Entries = map[string]uint64{}
+		for _, idxKey := range before.Indexes {
+			n, ok := before.Entries[idxKey]
+			if !ok {
+				continue
+			}
+			if !slices.Contains(after.Indexes, idxKey) || before.ID != after.ID {
+				removed = append(removed, indexEntryKey(idxKey, n))
+			} else {
+				after.Entries[idxKey] = n
+			}
+		}
+		for i, idxKey := range after.Indexes {
+			if _, ok := after.Entries[idxKey]; ok || slices.Contains(after.Indexes[:i], idxKey) {
+				continue
+			}
+			added = append(added, indexEntry{key: idxKey, id: after.ID})
+			addedTo = append(addedTo, key)
+		}
+		for _, counter := range before.Counters {
+			deltas[counter]--
+		}
+		for _, counter := range after.Counters {
+			deltas[counter]++
+		}
+		next[key] = after
+	}
+
+	// Update indexes
+	err := deleteIndexEntries(bucket, removed)
+	if err != nil {
+		return err
+	}
+	slots, err := addIndexEntries(bucket, added)
+	if err != nil {
+		return err
+	}
+	for i, entry := range added {
+		next[addedTo[i]].Entries[entry.key] = slots[i]
+	}
+
+	// Update counts
+	err = updateStats(bucket, deltas)
+	if err != nil {
+		return err
+	}
+
+	// Set derivations
+	keyValues := []cm.Tuple[string, cm.List[uint8]]{}
+	deleted := []string{}
+	for _, key := range keys {
+		d := next[key]
+		if d.empty() {
+			deleted = append(deleted, derivedKey(key))
+			continue
+		}
+		dBytes, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		keyValues = append(keyValues, cm.Tuple[string, cm.List[uint8]]{F0: derivedKey(key), F1: cm.ToList(dBytes)})
+	}
+	if len(keyValues) > 0 {
+		setRes := batch.SetMany(bucket, cm.ToList(keyValues))
+		if setRes.IsErr() {
+			return newStoreError("error setting derived values", setRes.Err())
+		}
+	}
+	if len(deleted) > 0 {
+		delRes := batch.DeleteMany(bucket, cm.ToList(deleted))
+		if delRes.IsErr() {
+			return newStoreError("error deleting derived values", delRes.Err())
+		}
+	}
+	return nil
+}
+
+// readStats returns the aggregate counts, keyed by counter name.
+func readStats(bucket store.Bucket) (map[string]int64, error) {
+	stats := map[string]int64{}
+
+	keys, err := allKeys(bucket)
+	if err != nil {
+		return stats, err
+	}
+	for _, key := range keys {
+		name, ok := strings.CutPrefix(key, statsPrefix)
+		if !ok {
+			continue
+		}
+		res := atomics.Increment(bucket, key, 0)
+		if res.IsErr() {
+			return stats, newStoreError("error getting stats value", res.Err())
+		}
+		if counter, ok := strings.CutPrefix(name, "-:"); ok {
+			stats[counter] -= int64(*res.OK())
+		} else if counter, ok := strings.CutPrefix(name, "+:"); ok {
+			stats[counter] += int64(*res.OK())
+		}
+	}
+
+	for counter, count := range stats {
+		if count <= 0 {
+			delete(stats, counter)
+		}
+	}
+	return stats, nil
+}
+
+// updateStats adds the deltas to the aggregate counts.
+func updateStats(bucket store.Bucket, deltas map[string]int64) error {
+	for counter, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		res := atomics.Increment(bucket, statKey(counter, delta < 0), uint64(max(delta, -delta)))
+		if res.IsErr() {
+			return newStoreError("error incrementing stats value", res.Err())
+		}
+	}
+	return nil
+}
+
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Reading stats")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Read stats
+	stats, err := readStats(*bucket)
+	if err != nil {
+		logger.Error("Error reading stats", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	statsResponse := map[string]any{
+		"counts": stats,
+	}
+	writeJSON(w, http.StatusOK, statsResponse)
+}
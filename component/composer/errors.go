@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/jsonpatch"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+	"github.com/jamesstocktonj1/mulib/pkg/recording"
+	"github.com/jamesstocktonj1/mulib/pkg/webhook"
+	"github.com/jamesstocktonj1/mulib/pkg/work"
+)
+
+const (
+	requestIDHeader = "X-Request-Id"
+)
+
+// storeError wraps a wasi:keyvalue error so it can be returned as a Go error.
+type storeError struct {
+	op  string
+	err store.Error
+}
+
+func newStoreError(op string, err *store.Error) error {
+	return &storeError{op: op, err: *err}
+}
+
+func (e *storeError) Error() string {
+	switch {
+	case e.err.NoSuchStore():
+		return e.op + ": no such store"
+	case e.err.AccessDenied():
+		return e.op + ": access denied"
+	case e.err.Other() != nil:
+		return e.op + ": " + *e.err.Other()
+	default:
+		return e.op
+	}
+}
+
+// problem maps the keyvalue error variant onto a problem. The store is a
+// dependency of the service, so its failures are reported as server errors.
+func (e *storeError) problem() *problem.Problem {
+	switch {
+	case e.err.NoSuchStore():
+		return problem.New(http.StatusServiceUnavailable, problem.CodeStoreUnavailable, e.Error())
+	case e.err.AccessDenied():
+		return problem.New(http.StatusInternalServerError, problem.CodeStoreAccessDenied, e.Error())
+	default:
+		return problem.New(http.StatusInternalServerError, problem.CodeStoreError, e.Error())
+	}
+}
+
+// setRequestID makes sure the request carries an id, generating one if the
+// caller didn't send it, and echoes it in the response.
+func setRequestID(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		id = uuid.New().String()
+		r.Header.Set(requestIDHeader, id)
+	}
+	w.Header().Set(requestIDHeader, id)
+}
+
+// errorProblem maps err onto the problem describing it to the client. Request
+// bodies which fail to decode are reported as problems where they are read, so
+// any other error, including a stored value which fails to decode, is a server
+// error whose cause is logged rather than shown.
+func errorProblem(err error) *problem.Problem {
+	var (
+		prob      *problem.Problem
+		storeErr  *storeError
+		verr      *composer.ValidationError
+		workErr   *work.ValidationError
+		recErr    *recording.ValidationError
+		hookErr   *webhook.ValidationError
+		deniedErr *auth.DeniedError
+	)
+	switch {
+	case errors.As(err, &prob):
+		return prob
+	case errors.As(err, &storeErr):
+		return storeErr.problem()
+	case errors.As(err, &verr):
+		prob = problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "invalid composer")
+		prob.Errors = verr.Fields
+		return prob
+	case errors.As(err, &workErr):
+		prob = problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "invalid work")
+		prob.Errors = workErr.Fields
+		return prob
+	case errors.As(err, &recErr):
+		prob = problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "invalid record")
+		prob.Errors = recErr.Fields
+		return prob
+	case errors.As(err, &hookErr):
+		prob = problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "invalid subscription")
+		prob.Errors = hookErr.Fields
+		return prob
+	case errors.As(err, &deniedErr):
+		if len(deniedErr.Fields) == 0 {
+			return problem.New(http.StatusForbidden, problem.CodeForbidden, deniedErr.Error())
+		}
+		prob = problem.New(http.StatusForbidden, problem.CodeForbidden, "not permitted to change some fields")
+		prob.Errors = deniedFieldErrors(deniedErr)
+		return prob
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		return problem.New(http.StatusConflict, problem.CodeConflict, err.Error())
+	case errors.Is(err, jsonpatch.ErrInvalidPatch), errors.Is(err, jsonpatch.ErrInvalidPath):
+		return problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error())
+	default:
+		logger.Error("Internal error", "error", err)
+		return problem.New(http.StatusInternalServerError, problem.CodeInternal, "internal error")
+	}
+}
+
+// deniedFieldErrors lists the fields a principal was denied changing.
+func deniedFieldErrors(err *auth.DeniedError) []composer.FieldError {
+	fields := make([]composer.FieldError, len(err.Fields))
+	for i, field := range err.Fields {
+		fields[i] = composer.FieldError{Field: field, Message: "not covered by the " + string(err.Permission) + " permission"}
+	}
+	return fields
+}
+
+// writeError writes err as a problem+json response, tagged with the request.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	prob := *errorProblem(err)
+	prob.Instance = r.URL.Path
+	prob.RequestID = r.Header.Get(requestIDHeader)
+
+	err = prob.Write(w)
+	if err != nil {
+		logger.Error("Error encoding response", "error", err)
+	}
+}
+
+// writeProblem writes a problem+json response with the given status, code and
+// detail.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code problem.Code, detail string) {
+	writeError(w, r, problem.New(status, code, detail))
+}
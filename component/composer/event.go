@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasmcloud/messaging/consumer"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasmcloud/messaging/types"
+	"github.com/jamesstocktonj1/mulib/pkg/cloudevents"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+)
+
+// Every write to a composer, or to a record served by a resource, publishes an
+// event through the messaging link once the write has succeeded. The subject
+// of each event type is configurable with "subject-<type>", e.g.
+// "subject-composer-created", and defaults to "mulib.<type>". Events are fire
+// and forget: a failure to publish is logged but doesn't fail the request, as
+// the write has already been made.
+//
+// Events are CloudEvents in structured mode, as broker messages have no
+// headers to carry the attributes of binary mode.
+const (
+	configSubjectPrefix  = "subject-"
+	defaultSubjectPrefix = "mulib."
+
+	// composerEventSchema identifies the schema of composer.Event.
+	composerEventSchema = "urn:mulib:schema:composer-event:1"
+)
+
+// eventSubject returns the subject events of the given type are published to.
+func eventSubject(eventType string) string {
+	key := configSubjectPrefix + strings.ReplaceAll(eventType, ".", "-")
+	return configValue(key, defaultSubjectPrefix+eventType)
+}
+
+// composerCloudEvent returns the CloudEvent for a write of after, which was
+// before until the write. before is nil for a new composer.
+func composerCloudEvent(actor, action string, before *composer.Composer, after composer.Composer) (cloudevents.Event, error) {
+	data := composer.Event{
+		ComposerID: after.ID,
+		Revision:   after.Revision,
+		Action:     action,
+		ChangedBy:  actor,
+		ChangedAt:  after.UpdatedAt,
+		Before:     before,
+		After:      &after,
+	}
+	return cloudevents.New(componentName, composer.EventType(action), after.ID, now(), composerEventSchema, data)
+}
+
+// publishComposerEvent publishes the event for a write of after, which was
+// before until the write, and delivers it to the matching webhooks. before is
+// nil for a new composer.
+func publishComposerEvent(bucket store.Bucket, actor, action string, before *composer.Composer, after composer.Composer) {
+	event, err := composerCloudEvent(actor, action, before, after)
+	if err != nil {
+		logger.Error("Error creating event", "action", action, "id", after.ID, "error", err)
+		return
+	}
+	publishEvent(bucket, event)
+}
+
+// publishEvent publishes event through the messaging link and then delivers it
+// to the matching webhooks.
+func publishEvent(bucket store.Bucket, event cloudevents.Event) {
+	eventBytes, err := event.Structured()
+	if err != nil {
+		logger.Error("Error encoding event", "type", event.Type, "id", event.Subject, "error", err)
+		return
+	}
+
+	msg := types.BrokerMessage{
+		Subject: eventSubject(event.Type),
+		Body:    cm.ToList(eventBytes),
+		ReplyTo: cm.None[string](),
+	}
+	res := consumer.Publish(msg)
+	if res.IsErr() {
+		logger.Error("Error publishing event", "type", event.Type, "id", event.Subject, "error", *res.Err())
+	}
+
+	deliverWebhooks(bucket, event, eventBytes)
+}
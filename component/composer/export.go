@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/batch"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+	"github.com/jamesstocktonj1/mulib/pkg/work"
+)
+
+// An export walks the list-keys pages of the bucket and reads each page with
+// get-many, writing every record to the response as soon as it is read so that
+// the component never holds more than one page. The status is sent before the
+// first record, so an error part way through can only end the response early:
+// a JSON array export is then left unterminated, while NDJSON and CSV exports
+// are cut short at the last complete record.
+const (
+	exportBatchSize = 100
+
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatJSON   = "json"
+)
+
+// exportSource describes how to export one kind of record.
+type exportSource struct {
+	name    string
+	columns []string
+
+	// match reports whether a key holds a record to export.
+	match func(key string) bool
+
+	// decode decodes a stored record, returning it as a CSV record as well.
+	// The boolean result is false to leave the record out of the export.
+	decode func(value []byte, includeDeleted bool) (any, []string, bool, error)
+}
+
+var (
+	composerExport = exportSource{
+		name:    "composers",
+		columns: composer.CSVColumns,
+		match:   isComposerKey,
+		decode: func(value []byte, includeDeleted bool) (any, []string, bool, error) {
+			comp := composer.Composer{}
+			err := json.Unmarshal(value, &comp)
+			if err != nil || (comp.Deleted() && !includeDeleted) {
+				return nil, nil, false, err
+			}
+			return comp, comp.CSVRecord(), true, nil
+		},
+	}
+
+	workExport = exportSource{
+		name:    "works",
+		columns: work.CSVColumns,
+		match: func(key string) bool {
+			return strings.HasPrefix(key, works.prefix)
+		},
+		decode: func(value []byte, _ bool) (any, []string, bool, error) {
+			wk := work.Work{}
+			err := json.Unmarshal(value, &wk)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			return wk, wk.CSVRecord(), true, nil
+		},
+	}
+)
+
+// exportHandler returns a handler streaming every record of src in the
+// format given by the format query, which defaults to NDJSON.
+func exportHandler(src exportSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.Info("Exporting " + src.name)
+
+		// Get format
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = formatNDJSON
+		}
+		var contentType string
+		switch format {
+		case formatNDJSON:
+			contentType = ndjsonType
+		case formatCSV:
+			contentType = csvType
+		case formatJSON:
+			contentType = "application/json"
+		default:
+			logger.Error("Invalid format query", "format", format)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "format must be ndjson, csv or json")
+			return
+		}
+
+		// Get deleted
+		includeDeleted := false
+		if v := r.URL.Query().Get("includeDeleted"); v != "" {
+			var err error
+			includeDeleted, err = strconv.ParseBool(v)
+			if err != nil {
+				logger.Error("Invalid includeDeleted query", "includeDeleted", v)
+				writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid includeDeleted query")
+				return
+			}
+		}
+
+		// Open bucket
+		bucketRes := store.Open(componentName)
+		if bucketRes.IsErr() {
+			logger.Error("Error opening bucket", "error", bucketRes.Err())
+			writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+			return
+		}
+		bucket := bucketRes.OK()
+
+		// Write header
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+src.name+"."+format+`"`)
+		w.WriteHeader(http.StatusOK)
+
+		// Write records
+		exp := &exporter{w: w, format: format}
+		err := exp.begin(src.columns)
+		if err == nil {
+			err = walkValues(*bucket, src.match, func(value []byte) error {
+				v, record, ok, err := src.decode(value, includeDeleted)
+				if err != nil || !ok {
+					return err
+				}
+				return exp.write(v, record)
+			})
+		}
+		if err == nil {
+			err = exp.end()
+		}
+		if err != nil {
+			logger.Error("Error exporting "+src.name, "written", exp.count, "error", err)
+			return
+		}
+		logger.Info("Exported "+src.name, "written", exp.count)
+	}
+}
+
+// walkValues calls fn with the value of every key matching match, reading the
+// keys of each list-keys page with get-many.
+func walkValues(bucket store.Bucket, match func(key string) bool, fn func(value []byte) error) error {
+	cursor := cm.None[uint64]()
+	for {
+		keysRes := bucket.ListKeys(cursor)
+		if keysRes.IsErr() {
+			return newStoreError("error listing keys", keysRes.Err())
+		}
+
+		keys := []string{}
+		for _, key := range keysRes.OK().Keys.Slice() {
+			if match(key) {
+				keys = append(keys, key)
+			}
+		}
+
+		for start := 0; start < len(keys); start += exportBatchSize {
+			end := min(start+exportBatchSize, len(keys))
+			getRes := batch.GetMany(bucket, cm.ToList(keys[start:end]))
+			if getRes.IsErr() {
+				return newStoreError("error getting values", getRes.Err())
+			}
+			for _, kv := range getRes.OK().Slice() {
+				some := kv.Some()
+				if some == nil {
+					continue
+				}
+				err := fn(some.F1.Slice())
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		cursor = keysRes.OK().Cursor
+		if cursor.None() {
+			return nil
+		}
+	}
+}
+
+// exporter writes records to the response in one of the export formats,
+// flushing after each so that the response is streamed.
+type exporter struct {
+	w      http.ResponseWriter
+	format string
+	csv    *csv.Writer
+	count  int
+}
+
+func (e *exporter) begin(columns []string) error {
+	switch e.format {
+	case formatCSV:
+		e.csv = csv.NewWriter(e.w)
+		return e.csv.Write(columns)
+	case formatJSON:
+		_, err := e.w.Write([]byte("["))
+		return err
+	}
+	return nil
+}
+
+func (e *exporter) write(v any, record []string) error {
+	var err error
+	switch e.format {
+	case formatCSV:
+		err = e.csv.Write(record)
+		if err == nil {
+			e.csv.Flush()
+			err = e.csv.Error()
+		}
+	default:
+		var b []byte
+		b, err = json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if e.format == formatJSON && e.count > 0 {
+			b = append([]byte(","), b...)
+		}
+		if e.format == formatNDJSON {
+			b = append(b, '\n')
+		}
+		_, err = e.w.Write(b)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.count++
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func (e *exporter) end() error {
+	switch e.format {
+	case formatCSV:
+		e.csv.Flush()
+		return e.csv.Error()
+	case formatJSON:
+		_, err := e.w.Write([]byte("]\n"))
+		return err
+	}
+	return nil
+}
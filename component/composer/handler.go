@@ -2,16 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
+	"time"
 
 	"github.com/bytecodealliance/wasm-tools-go/cm"
 	"github.com/google/uuid"
 	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
 	"github.com/jamesstocktonj1/mulib/pkg/composer"
-)
-
-const (
-	ErrBadRequest = "err:"
+	"github.com/jamesstocktonj1/mulib/pkg/jsonpatch"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
 )
 
 func createHandler(w http.ResponseWriter, r *http.Request) {
@@ -22,7 +24,7 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&comp)
 	if err != nil {
 		logger.Error("Error decoding request", "error", err)
-		http.Error(w, "error decoding request", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
 		return
 	}
 
@@ -30,39 +32,16 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 	bucketRes := store.Open(componentName)
 	if bucketRes.IsErr() {
 		logger.Error("Error opening bucket", "error", bucketRes.Err())
-		http.Error(w, "error opening bucket", http.StatusInternalServerError)
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
 		return
 	}
 	bucket := bucketRes.OK()
 
-	// Set ID
-	comp.ID = uuid.New().String()
-
-	// Check if value exists
-	existsRes := bucket.Exists(comp.ID)
-	if existsRes.IsErr() {
-		logger.Error("Error checking if value exists", "error", existsRes.Err())
-		http.Error(w, "error checking if value exists", http.StatusInternalServerError)
-		return
-	} else if *existsRes.OK() {
-		logger.Error("Value already exist", "id", comp.ID, "result", *existsRes.OK())
-		http.Error(w, "value already exist", http.StatusNotFound)
-		return
-	}
-
-	// Marshal value
-	compBytes, err := json.Marshal(comp)
+	// Create value
+	comp, err = createComposer(*bucket, actor(r), principal(r), comp)
 	if err != nil {
-		logger.Error("Error marshalling value", "error", err)
-		http.Error(w, "error marshalling value", http.StatusInternalServerError)
-		return
-	}
-
-	// Set value
-	res := bucket.Set(comp.ID, cm.ToList(compBytes))
-	if res.IsErr() {
-		logger.Error("Error setting value", "error", res.Err())
-		http.Error(w, "error setting value", http.StatusInternalServerError)
+		logger.Error("Error creating composer", "error", err)
+		writeError(w, r, err)
 		return
 	}
 
@@ -71,95 +50,86 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 		"id":      comp.ID,
 		"message": "composer created",
 	}
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
-	err = enc.Encode(idResponse)
-	if err != nil {
-		logger.Error("Error encoding response", "error", err)
-		http.Error(w, "error encoding response", http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Location", publicPath("/composers/"+comp.ID))
+	setValidators(w, comp)
+	writeJSON(w, http.StatusCreated, idResponse)
 }
 
 func readHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Reading composer")
 
 	// Get composer ID
-	id := r.URL.Query().Get("composer")
-	if id == "" {
-		logger.Error("No composer query provided")
-		http.Error(w, "no composer query provided", http.StatusBadRequest)
-		return
-	}
+	id := r.PathValue("id")
 
 	// Open bucket
 	bucketRes := store.Open(componentName)
 	if bucketRes.IsErr() {
 		logger.Error("Error opening bucket", "error", bucketRes.Err())
-		http.Error(w, "error opening bucket", http.StatusInternalServerError)
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
 		return
 	}
 	bucket := bucketRes.OK()
 
-	// Check if value exists
-	existsRes := bucket.Exists(id)
-	if existsRes.IsErr() {
-		logger.Error("Error checking if value exists", "error", existsRes.Err())
-		http.Error(w, "error checking if value exists", http.StatusInternalServerError)
+	// Get value
+	comp, ok, err := getComposer(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
 		return
-	} else if !(*existsRes.OK()) {
-		logger.Error("Value does not exist", "id", id, "result", *existsRes.OK())
-		http.Error(w, "value does not exist", http.StatusNotFound)
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "composer does not exist")
 		return
 	}
 
-	// Get value
-	res := bucket.Get(id)
-	if res.IsErr() {
-		logger.Error("Error getting value", "error", res.Err())
-		http.Error(w, "error reading value", http.StatusInternalServerError)
+	// Get revision at time, which a composer now in the trash may have
+	if asOf := r.URL.Query().Get("asOf"); asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			logger.Error("Invalid asOf query", "asOf", asOf)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid asOf query")
+			return
+		}
+		comp, ok, err = composerAsOf(*bucket, comp, t)
+		if err != nil {
+			logger.Error("Error getting history", "id", id, "error", err)
+			writeError(w, r, err)
+			return
+		} else if !ok || comp.Deleted() {
+			logger.Error("Value did not exist", "id", id, "asOf", asOf)
+			writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "composer did not exist at asOf")
+			return
+		}
+	} else if comp.Deleted() {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "composer does not exist")
 		return
 	}
 
-	// Unmarshal value
-	comp := composer.Composer{}
-	err := json.Unmarshal(res.OK().Some().Slice(), &comp)
-	if err != nil {
-		logger.Error("Error unmarshalling bucket.Get value", "error", err)
-		http.Error(w, "error reading value", http.StatusInternalServerError)
+	// Check precondition
+	setValidators(w, comp)
+	setCacheHeaders(w, composersResource)
+	if notModified(r, etag(comp), comp.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	// Marshal response
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
-	err = enc.Encode(comp)
-	if err != nil {
-		logger.Error("Error encoding response", "error", err)
-		http.Error(w, "error encoding response", http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(http.StatusOK)
+	// Write response
+	writeJSON(w, http.StatusOK, comp)
 }
 
 func updateHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Updating composer")
 
 	// Get composer ID
-	id := r.URL.Query().Get("composer")
-	if id == "" {
-		logger.Error("No composer query provided")
-		http.Error(w, "no composer query provided", http.StatusBadRequest)
-		return
-	}
+	id := r.PathValue("id")
 
 	// Unmarshal request
 	compPut := composer.Composer{}
 	err := json.NewDecoder(r.Body).Decode(&compPut)
 	if err != nil {
 		logger.Error("Error decoding request", "error", err)
-		http.Error(w, "error decoding request", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
 		return
 	}
 
@@ -167,125 +137,126 @@ func updateHandler(w http.ResponseWriter, r *http.Request) {
 	bucketRes := store.Open(componentName)
 	if bucketRes.IsErr() {
 		logger.Error("Error opening bucket", "error", bucketRes.Err())
-		http.Error(w, "error opening bucket", http.StatusInternalServerError)
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
 		return
 	}
 	bucket := bucketRes.OK()
 
-	// Check if value exists
-	existsRes := bucket.Exists(id)
-	if existsRes.IsErr() {
-		logger.Error("Error checking if value exists", "error", existsRes.Err())
-		http.Error(w, "error checking if value exists", http.StatusInternalServerError)
-		return
-	} else if !(*existsRes.OK()) {
-		logger.Error("Value does not exist", "id", id, "result", *existsRes.OK())
-		http.Error(w, "value does not exist", http.StatusNotFound)
+	// Update value
+	comp, err := updateComposer(*bucket, actor(r), principal(r), id, func(tag string) bool { return ifMatch(r, tag) }, compPut)
+	if err != nil {
+		logger.Error("Error updating composer", "id", id, "error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	// Get value
-	res := bucket.Get(id)
-	if res.IsErr() {
-		logger.Error("Error getting value", "error", res.Err())
-		http.Error(w, "error reading value", http.StatusInternalServerError)
+	// Write response
+	setValidators(w, comp)
+	writeJSON(w, http.StatusOK, comp)
+}
+
+func patchHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Patching composer")
+
+	// Get composer ID
+	id := r.PathValue("id")
+
+	// Get patch format
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != jsonpatch.MergePatchType && mediaType != jsonpatch.JSONPatchType) {
+		logger.Error("Unsupported patch media type", "contentType", r.Header.Get("Content-Type"))
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		writeProblem(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "unsupported patch media type")
 		return
 	}
 
-	// Unmarshal value
-	comp := composer.Composer{}
-	err = json.Unmarshal(res.OK().Some().Slice(), &comp)
+	// Read request
+	patch, err := io.ReadAll(r.Body)
 	if err != nil {
-		logger.Error("Error unmarshalling bucket.Get value", "error", err)
-		http.Error(w, "error reading value", http.StatusInternalServerError)
+		logger.Error("Error reading request", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "error reading request")
 		return
 	}
 
-	// Update value
-	if compPut.Firstname != "" {
-		comp.Firstname = compPut.Firstname
-	}
-	if compPut.Lastname != "" {
-		comp.Lastname = compPut.Lastname
-	}
-	if compPut.BirthDate != "" {
-		comp.BirthDate = compPut.BirthDate
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
 	}
-	if compPut.DeathDate != "" {
-		comp.DeathDate = compPut.DeathDate
+	bucket := bucketRes.OK()
+
+	// Get value
+	comp, err := getLiveComposer(*bucket, id, func(tag string) bool { return ifMatch(r, tag) })
+	if err != nil {
+		logger.Error("Error getting composer", "id", id, "error", err)
+		writeError(w, r, err)
+		return
 	}
-	if compPut.Era != "" {
-		comp.Era = compPut.Era
+
+	// Apply patch
+	before := comp
+	if mediaType == jsonpatch.MergePatchType {
+		comp, err = composer.MergePatch(comp, patch)
+	} else {
+		comp, err = composer.JSONPatch(comp, patch)
 	}
-	if compPut.Nationality != "" {
-		comp.Nationality = compPut.Nationality
+	if err != nil {
+		logger.Error("Error applying patch", "error", err)
+		writeError(w, r, err)
+		return
 	}
 
-	// Marshal value
-	compBytes, err := json.Marshal(comp)
+	// Check permission
+	err = principal(r).Check(composersResource, auth.ActionUpdate, composer.ChangedFields(before, comp))
 	if err != nil {
-		logger.Error("Error marshalling value", "error", err)
-		http.Error(w, "error marshalling value", http.StatusInternalServerError)
+		logger.Error("Principal may not change composer", "id", id, "error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	// Set value
-	setRes := bucket.Set(id, cm.ToList(compBytes))
-	if setRes.IsErr() {
-		logger.Error("Error setting value", "error", setRes.Err())
-		http.Error(w, "error setting value", http.StatusInternalServerError)
+	// Validate value
+	err = comp.Validate()
+	if err != nil {
+		logger.Error("Invalid composer", "error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	// Marshal response
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
-	err = enc.Encode(comp)
+	// Set value
+	comp, err = putComposer(*bucket, actor(r), composer.ActionUpdated, &before, comp)
 	if err != nil {
-		logger.Error("Error encoding response", "error", err)
-		http.Error(w, "error encoding response", http.StatusInternalServerError)
+		logger.Error("Error setting value", "error", err)
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+
+	// Write response
+	setValidators(w, comp)
+	writeJSON(w, http.StatusOK, comp)
 }
 
 func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Deleting composer")
 
 	// Get composer ID
-	id := r.URL.Query().Get("composer")
-	if id == "" {
-		logger.Error("No composer query provided")
-		http.Error(w, "no composer query provided", http.StatusBadRequest)
-		return
-	}
+	id := r.PathValue("id")
 
 	// Open bucket
 	bucketRes := store.Open(componentName)
 	if bucketRes.IsErr() {
 		logger.Error("Error opening bucket", "error", bucketRes.Err())
-		http.Error(w, "error opening bucket", http.StatusInternalServerError)
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
 		return
 	}
 	bucket := bucketRes.OK()
 
-	// Check if value exists
-	existsRes := bucket.Exists(id)
-	if existsRes.IsErr() {
-		logger.Error("Error checking if value exists", "error", existsRes.Err())
-		http.Error(w, "error checking if value exists", http.StatusInternalServerError)
-		return
-	} else if !(*existsRes.OK()) {
-		logger.Error("Value does not exist", "id", id, "result", *existsRes.OK())
-		http.Error(w, "value does not exist", http.StatusNotFound)
-		return
-	}
-
-	// Delete value
-	res := bucket.Delete(id)
-	if res.IsErr() {
-		logger.Error("Error deleting value", "error", res.Err())
-		http.Error(w, "error deleting value", http.StatusInternalServerError)
+	// Move value to trash
+	_, err := deleteComposer(*bucket, actor(r), principal(r), id, func(tag string) bool { return ifMatch(r, tag) })
+	if err != nil {
+		logger.Error("Error deleting composer", "id", id, "error", err)
+		writeError(w, r, err)
 		return
 	}
 
@@ -294,13 +265,181 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		"id":      id,
 		"message": "composer deleted",
 	}
+	writeJSON(w, http.StatusOK, idResponse)
+}
+
+// createComposer validates comp and stores it as a new composer with a new
+// id, if p may set the fields it sets.
+func createComposer(bucket store.Bucket, actor string, p auth.Principal, comp composer.Composer) (composer.Composer, error) {
+	// Set ID
+	comp = composer.Composer{ID: uuid.New().String()}.Replace(comp)
+
+	// Check permission
+	err := p.Check(composersResource, auth.ActionCreate, composer.ChangedFields(composer.Composer{}, comp))
+	if err != nil {
+		return comp, err
+	}
+
+	// Validate value
+	err = comp.Validate()
+	if err != nil {
+		return comp, err
+	}
+
+	// Check if value exists
+	existsRes := bucket.Exists(comp.ID)
+	if existsRes.IsErr() {
+		return comp, newStoreError("error checking if value exists", existsRes.Err())
+	} else if *existsRes.OK() {
+		return comp, problem.New(http.StatusConflict, problem.CodeConflict, "composer already exists")
+	}
+
+	// Set value
+	return putComposer(bucket, actor, composer.ActionCreated, nil, comp)
+}
+
+// updateComposer replaces the composer stored at id with next, once match has
+// accepted the entity tag of its current revision, if p may change the fields
+// it changes.
+func updateComposer(bucket store.Bucket, actor string, p auth.Principal, id string, match func(tag string) bool, next composer.Composer) (composer.Composer, error) {
+	// Get value
+	comp, err := getLiveComposer(bucket, id, match)
+	if err != nil {
+		return comp, err
+	}
+
+	// Replace value
+	before := comp
+	comp = comp.Replace(next)
+
+	// Check permission
+	err = p.Check(composersResource, auth.ActionUpdate, composer.ChangedFields(before, comp))
+	if err != nil {
+		return comp, err
+	}
+
+	// Validate value
+	err = comp.Validate()
+	if err != nil {
+		return comp, err
+	}
+
+	// Set value
+	return putComposer(bucket, actor, composer.ActionUpdated, &before, comp)
+}
+
+// deleteComposer moves the composer stored at id to the trash, once match has
+// accepted the entity tag of its current revision, if p may delete it.
+func deleteComposer(bucket store.Bucket, actor string, p auth.Principal, id string, match func(tag string) bool) (composer.Composer, error) {
+	// Check permission
+	err := p.Check(composersResource, auth.ActionDelete, nil)
+	if err != nil {
+		return composer.Composer{}, err
+	}
+
+	// Get value
+	comp, err := getLiveComposer(bucket, id, match)
+	if err != nil {
+		return comp, err
+	}
+
+	// Move value to trash
+	before := comp
+	deletedAt := now()
+	comp.DeletedAt = &deletedAt
+	return putComposer(bucket, actor, composer.ActionDeleted, &before, comp)
+}
+
+// getLiveComposer reads the composer stored at id, failing if it doesn't
+// exist, is in the trash, or match rejects the entity tag of its revision.
+func getLiveComposer(bucket store.Bucket, id string, match func(tag string) bool) (composer.Composer, error) {
+	comp, ok, err := getComposer(bucket, id)
+	if err != nil {
+		return comp, err
+	} else if !ok || comp.Deleted() {
+		return comp, problem.New(http.StatusNotFound, problem.CodeNotFound, "composer does not exist")
+	}
+
+	// Check precondition
+	if !match(etag(comp)) {
+		return comp, problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed, "revision does not match")
+	}
+	return comp, nil
+}
+
+// getComposer reads and decodes the composer stored at id. The boolean result
+// is false when the key has no value, which can happen when a key is deleted
+// between listing and reading it.
+func getComposer(bucket store.Bucket, id string) (composer.Composer, bool, error) {
+	comp := composer.Composer{}
+
+	res := bucket.Get(id)
+	if res.IsErr() {
+		return comp, false, newStoreError("error getting value", res.Err())
+	}
+	value := res.OK().Some()
+	if value == nil {
+		return comp, false, nil
+	}
+
+	err := json.Unmarshal(value.Slice(), &comp)
+	if err != nil {
+		return comp, false, err
+	}
+	return comp, true, nil
+}
+
+// putComposer writes the next revision of comp, records it in the history and
+// publishes the change from before, which is nil for a new composer. It
+// returns the composer as stored.
+func putComposer(bucket store.Bucket, actor, action string, before *composer.Composer, comp composer.Composer) (composer.Composer, error) {
+	comp.Revision++
+	comp.UpdatedAt = now()
+
+	// Set history before the value so that no revision goes unrecorded
+	entry := composer.HistoryEntry{
+		Revision:  comp.Revision,
+		Action:    action,
+		ChangedBy: actor,
+		ChangedAt: comp.UpdatedAt,
+		Composer:  comp,
+	}
+	if before != nil {
+		entry.Changes = composer.Diff(*before, comp)
+	} else {
+		entry.Changes = composer.Diff(composer.Composer{}, comp)
+	}
+	err := putHistory(bucket, entry)
+	if err != nil {
+		return comp, err
+	}
+
+	// Marshal value
+	compBytes, err := json.Marshal(comp)
+	if err != nil {
+		return comp, err
+	}
+
+	// Set value
+	res := bucket.Set(comp.ID, cm.ToList(compBytes))
+	if res.IsErr() {
+		return comp, newStoreError("error setting value", res.Err())
+	}
+
+	// Publish event
+	publishComposerEvent(bucket, actor, action, before, comp)
+	return comp, nil
+}
+
+// writeJSON writes v as the indented JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
-	err := enc.Encode(idResponse)
+	err := enc.Encode(v)
 	if err != nil {
 		logger.Error("Error encoding response", "error", err)
-		http.Error(w, "error encoding response", http.StatusInternalServerError)
-		return
 	}
-	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+// The history of a composer is stored as one append-only key per revision,
+// "hist:<id>:<revision>". As revisions are numbered from one, the history can
+// be read back without listing keys.
+const (
+	historyPrefix = "hist:"
+)
+
+func historyKey(id string, revision uint64) string {
+	return historyPrefix + id + ":" + strconv.FormatUint(revision, 10)
+}
+
+// actor returns who is making the request, as recorded in the history. The
+// authenticated principal is preferred over the X-User header.
+func actor(r *http.Request) string {
+	if p, ok := auth.PrincipalFrom(r.Context()); ok {
+		return p.Subject
+	}
+	if user := r.Header.Get("X-User"); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+func getHistory(bucket store.Bucket, id string, revision uint64) (composer.HistoryEntry, bool, error) {
+	entry := composer.HistoryEntry{}
+
+	res := bucket.Get(historyKey(id, revision))
+	if res.IsErr() {
+		return entry, false, newStoreError("error getting history value", res.Err())
+	}
+	value := res.OK().Some()
+	if value == nil {
+		return entry, false, nil
+	}
+
+	err := json.Unmarshal(value.Slice(), &entry)
+	if err != nil {
+		return entry, false, err
+	}
+	return entry, true, nil
+}
+
+func putHistory(bucket store.Bucket, entry composer.HistoryEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	res := bucket.Set(historyKey(entry.Composer.ID, entry.Revision), cm.ToList(entryBytes))
+	if res.IsErr() {
+		return newStoreError("error setting history value", res.Err())
+	}
+	return nil
+}
+
+// deleteHistory removes every revision of the record stored under id up to
+// revision.
+func deleteHistory(bucket store.Bucket, id string, revision uint64) error {
+	for rev := uint64(1); rev <= revision; rev++ {
+		res := bucket.Delete(historyKey(id, rev))
+		if res.IsErr() {
+			return newStoreError("error deleting history value", res.Err())
+		}
+	}
+	return nil
+}
+
+// composerAsOf returns the revision of the composer that was current at t.
+func composerAsOf(bucket store.Bucket, comp composer.Composer, t time.Time) (composer.Composer, bool, error) {
+	for rev := comp.Revision; rev > 0; rev-- {
+		entry, ok, err := getHistory(bucket, comp.ID, rev)
+		if err != nil {
+			return comp, false, err
+		} else if !ok {
+			continue
+		}
+		if !entry.ChangedAt.After(t) {
+			return entry.Composer, true, nil
+		}
+	}
+	return comp, false, nil
+}
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Reading composer history")
+
+	// Get composer ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	comp, ok, err := getComposer(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "composer does not exist")
+		return
+	}
+
+	// Get history, newest first
+	entries := []composer.HistoryEntry{}
+	for rev := comp.Revision; rev > 0; rev-- {
+		entry, ok, err := getHistory(*bucket, id, rev)
+		if err != nil {
+			logger.Error("Error getting history", "id", id, "revision", rev, "error", err)
+			writeError(w, r, err)
+			return
+		} else if !ok {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	// Write response
+	historyResponse := map[string]any{
+		"id":      id,
+		"history": entries,
+	}
+	writeJSON(w, http.StatusOK, historyResponse)
+}
+
+func historyEntryHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Reading composer revision")
+
+	// Get composer ID and revision
+	id := r.PathValue("id")
+	revision, err := strconv.ParseUint(r.PathValue("revision"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid revision", "revision", r.PathValue("revision"))
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid revision")
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get history
+	entry, ok, err := getHistory(*bucket, id, revision)
+	if err != nil {
+		logger.Error("Error getting history", "id", id, "revision", revision, "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Revision does not exist", "id", id, "revision", revision)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "revision does not exist")
+		return
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func revertHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Reverting composer")
+
+	// Get composer ID and revision
+	id := r.PathValue("id")
+	revision, err := strconv.ParseUint(r.PathValue("revision"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid revision", "revision", r.PathValue("revision"))
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid revision")
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	comp, ok, err := getComposer(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok || comp.Deleted() {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "composer does not exist")
+		return
+	}
+
+	// Check precondition
+	if !ifMatch(r, etag(comp)) {
+		logger.Error("Revision does not match", "id", id, "etag", etag(comp))
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "revision does not match")
+		return
+	}
+
+	// Get history
+	entry, ok, err := getHistory(*bucket, id, revision)
+	if err != nil {
+		logger.Error("Error getting history", "id", id, "revision", revision, "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Revision does not exist", "id", id, "revision", revision)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "revision does not exist")
+		return
+	}
+
+	// Check permission
+	before := comp
+	comp = comp.Replace(entry.Composer)
+	err = principal(r).Check(composersResource, auth.ActionUpdate, composer.ChangedFields(before, comp))
+	if err != nil {
+		logger.Error("Principal may not change composer", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Validate value
+	err = comp.Validate()
+	if err != nil {
+		logger.Error("Invalid composer", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Set value
+	comp, err = putComposer(*bucket, actor(r), composer.ActionReverted, &before, comp)
+	if err != nil {
+		logger.Error("Error setting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	setValidators(w, comp)
+	writeJSON(w, http.StatusOK, comp)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/batch"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+// An import creates composers from the rows of a CSV or NDJSON body. Rows are
+// validated one at a time and written in batches with set-many, each composer
+// together with its first history entry. A row which names the id of an
+// existing composer is skipped, so an export can be imported again without
+// creating duplicates.
+const (
+	csvType    = "text/csv"
+	ndjsonType = "application/x-ndjson"
+
+	importBatchSize = 100
+
+	// maxImportLine is the longest NDJSON line accepted.
+	maxImportLine = 1 << 20
+)
+
+const (
+	rowCreated = "created"
+	rowSkipped = "skipped"
+	rowFailed  = "failed"
+)
+
+// importRow is the outcome of importing one row. Rows are numbered from one,
+// not counting the CSV header.
+type importRow struct {
+	Row     int                   `json:"row"`
+	Status  string                `json:"status"`
+	ID      string                `json:"id,omitempty"`
+	Message string                `json:"message,omitempty"`
+	Errors  []composer.FieldError `json:"errors,omitempty"`
+}
+
+type importResponse struct {
+	DryRun  bool        `json:"dryRun"`
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Rows    []importRow `json:"rows"`
+}
+
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Importing composers")
+
+	// Get import format
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != csvType && mediaType != ndjsonType) {
+		logger.Error("Unsupported import media type", "contentType", r.Header.Get("Content-Type"))
+		writeProblem(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "import must be "+csvType+" or "+ndjsonType)
+		return
+	}
+
+	// Get dry run
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			logger.Error("Invalid dryRun query", "dryRun", v)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid dryRun query")
+			return
+		}
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Import rows
+	imp := &importer{
+		bucket:    *bucket,
+		actor:     actor(r),
+		principal: principal(r),
+		seen:      map[string]bool{},
+		report:    importResponse{DryRun: dryRun, Rows: []importRow{}},
+	}
+	if mediaType == csvType {
+		err = imp.readCSV(r.Body)
+	} else {
+		err = imp.readNDJSON(r.Body)
+	}
+	if err != nil {
+		logger.Error("Error reading import", "error", err)
+		writeError(w, r, err)
+		return
+	}
+	imp.flush()
+
+	// Write response
+	slices.SortFunc(imp.report.Rows, func(a, b importRow) int {
+		return a.Row - b.Row
+	})
+	writeJSON(w, http.StatusOK, imp.report)
+}
+
+// importer validates rows and writes them in batches, recording the outcome
+// of every row in its report.
+type importer struct {
+	bucket    store.Bucket
+	actor     string
+	principal auth.Principal
+
+	// seen holds the ids of the rows so far, to skip repeats within the
+	// import.
+	seen    map[string]bool
+	pending []pendingRow
+	report  importResponse
+}
+
+type pendingRow struct {
+	row  int
+	comp composer.Composer
+}
+
+func (imp *importer) readCSV(body io.Reader) error {
+	rd := csv.NewReader(body)
+
+	header, err := rd.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return problem.New(http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
+	}
+	err = composer.CheckCSVHeader(header)
+	if err != nil {
+		return problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error())
+	}
+
+	for row := 1; ; row++ {
+		record, err := rd.Read()
+		var parseErr *csv.ParseError
+		if err == io.EOF {
+			return nil
+		} else if errors.As(err, &parseErr) {
+			imp.fail(row, "", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		imp.add(row, composer.FromCSV(header, record))
+	}
+}
+
+func (imp *importer) readNDJSON(body io.Reader) error {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	for row := 1; sc.Scan(); row++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		comp := composer.Composer{}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&comp)
+		if err != nil {
+			imp.fail(row, "", err)
+			continue
+		}
+		imp.add(row, comp)
+	}
+
+	err := sc.Err()
+	if err != nil {
+		return problem.New(http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
+	}
+	return nil
+}
+
+// add validates the composer of a row and queues it for the next batch. A
+// composer without an id is given a new one.
+func (imp *importer) add(row int, comp composer.Composer) {
+	if comp.ID == "" {
+		comp.ID = uuid.New().String()
+	} else if uuid.Validate(comp.ID) != nil {
+		imp.fail(row, comp.ID, errors.New("id must be a composer id"))
+		return
+	}
+	// Keep the row's DeletedAt, so a composer exported from the trash is
+	// imported into it
+	comp = composer.Composer{ID: comp.ID, DeletedAt: comp.DeletedAt}.Replace(comp)
+
+	err := imp.principal.Check(composersResource, auth.ActionCreate, composer.ChangedFields(composer.Composer{}, comp))
+	if err != nil {
+		imp.fail(row, comp.ID, err)
+		return
+	}
+
+	err = comp.Validate()
+	if err != nil {
+		imp.fail(row, comp.ID, err)
+		return
+	}
+	if imp.seen[comp.ID] {
+		imp.record(importRow{Row: row, Status: rowSkipped, ID: comp.ID, Message: "composer repeated in import"})
+		return
+	}
+	imp.seen[comp.ID] = true
+
+	imp.pending = append(imp.pending, pendingRow{row: row, comp: comp})
+	if len(imp.pending) >= importBatchSize {
+		imp.flush()
+	}
+}
+
+// flush writes the queued composers which don't exist yet with one set-many,
+// then adds them to the indexes. Nothing is written on a dry run.
+func (imp *importer) flush() {
+	rows := imp.pending
+	imp.pending = nil
+	if len(rows) == 0 {
+		return
+	}
+
+	// Check which composers exist
+	keys := make([]string, len(rows))
+	for i, p := range rows {
+		keys[i] = p.comp.ID
+	}
+	getRes := batch.GetMany(imp.bucket, cm.ToList(keys))
+	if getRes.IsErr() {
+		err := newStoreError("error getting values", getRes.Err())
+		for _, p := range rows {
+			imp.fail(p.row, p.comp.ID, err)
+		}
+		return
+	}
+	exists := map[string]bool{}
+	for _, kv := range getRes.OK().Slice() {
+		if some := kv.Some(); some != nil {
+			exists[some.F0] = true
+		}
+	}
+
+	// Build values and history entries
+	keyValues := []cm.Tuple[string, cm.List[uint8]]{}
+	created := []pendingRow{}
+	for _, p := range rows {
+		if exists[p.comp.ID] {
+			imp.record(importRow{Row: p.row, Status: rowSkipped, ID: p.comp.ID, Message: "composer already exists"})
+			continue
+		}
+
+		comp := p.comp
+		comp.Revision = 1
+		comp.UpdatedAt = now()
+		entry := composer.HistoryEntry{
+			Revision:  comp.Revision,
+			Action:    composer.ActionImported,
+			ChangedBy: imp.actor,
+			ChangedAt: comp.UpdatedAt,
+			Changes:   composer.Diff(composer.Composer{}, comp),
+			Composer:  comp,
+		}
+
+		compBytes, err := json.Marshal(comp)
+		if err != nil {
+			imp.fail(p.row, comp.ID, err)
+			continue
+		}
+		entryBytes, err := json.Marshal(entry)
+		if err != nil {
+			imp.fail(p.row, comp.ID, err)
+			continue
+		}
+		keyValues = append(keyValues,
+			cm.Tuple[string, cm.List[uint8]]{F0: historyKey(comp.ID, comp.Revision), F1: cm.ToList(entryBytes)},
+			cm.Tuple[string, cm.List[uint8]]{F0: comp.ID, F1: cm.ToList(compBytes)},
+		)
+		created = append(created, pendingRow{row: p.row, comp: comp})
+	}
+
+	// Set values
+	if !imp.report.DryRun && len(keyValues) > 0 {
+		setRes := batch.SetMany(imp.bucket, cm.ToList(keyValues))
+		if setRes.IsErr() {
+			err := newStoreError("error setting values", setRes.Err())
+			for _, p := range created {
+				imp.fail(p.row, p.comp.ID, err)
+			}
+			return
+		}
+	}
+
+	for _, p := range created {
+		if !imp.report.DryRun {
+			publishComposerEvent(imp.bucket, imp.actor, composer.ActionImported, nil, p.comp)
+		}
+		imp.record(importRow{Row: p.row, Status: rowCreated, ID: p.comp.ID})
+	}
+}
+
+// fail records a failed row, listing the invalid fields of a validation error
+// or the fields the principal may not set.
+func (imp *importer) fail(row int, id string, err error) {
+	result := importRow{Row: row, Status: rowFailed, ID: id, Message: err.Error()}
+	var (
+		verr      *composer.ValidationError
+		deniedErr *auth.DeniedError
+	)
+	if errors.As(err, &verr) {
+		result.Message = "invalid composer"
+		result.Errors = verr.Fields
+	} else if errors.As(err, &deniedErr) && len(deniedErr.Fields) > 0 {
+		result.Message = "not permitted to change some fields"
+		result.Errors = deniedFieldErrors(deniedErr)
+	}
+	imp.record(result)
+}
+
+func (imp *importer) record(result importRow) {
+	switch result.Status {
+	case rowCreated:
+		imp.report.Created++
+	case rowSkipped:
+		imp.report.Skipped++
+	case rowFailed:
+		imp.report.Failed++
+	}
+	imp.report.Rows = append(imp.report.Rows, result)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/atomics"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/batch"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+)
+
+// Secondary indexes are stored alongside the composers in the same bucket.
+// Each index key, e.g. "idx:era:baroque", holds an atomic counter of the
+// entries ever added to the index, and entry n lists its id under
+// "idx:#<n>:era:baroque". Adding an entry increments the counter to take the
+// next slot and sets it, and removing one deletes its slot, so writes to the
+// same index at once never lose each other's entries. The slot of each entry
+// is kept with the rest of the data derived from its record. An index is read
+// from its counter and a get-many of its slots, without walking the bucket.
+//
+// The slots of removed entries are not reused, so an index which changes often
+// costs more to read over time. The keyvalue store has no transactions either,
+// so an index can drift from the primary records if an update is interrupted.
+// The rebuild endpoint recreates every index, numbering its entries from one
+// again, along with the rest of the derived data.
+const (
+	indexPrefix = "idx:"
+
+	// trashIndexKey lists the composers in the trash, which are listed under
+	// no other index.
+	trashIndexKey = indexPrefix + "trash"
+)
+
+// isComposerKey reports whether key holds a primary composer record rather
+// than derived data.
+func isComposerKey(key string) bool {
+	return uuid.Validate(key) == nil
+}
+
+func indexKey(field, value string) string {
+	return indexPrefix + field + ":" + strings.ToLower(strings.TrimSpace(value))
+}
+
+// indexEntryKey returns the key of the entry in slot n of the index key.
+func indexEntryKey(key string, n uint64) string {
+	return indexPrefix + "#" + strconv.FormatUint(n, 10) + ":" + strings.TrimPrefix(key, indexPrefix)
+}
+
+// indexEntry lists id under the index key.
+type indexEntry struct {
+	key string
+	id  string
+}
+
+// indexKeys returns the index keys a composer should be listed under. Deleted
+// composers are only listed in the trash.
+func indexKeys(c composer.Composer) []string {
+	keys := []string{}
+	if c.Deleted() {
+		return append(keys, trashIndexKey)
+	}
+	if strings.TrimSpace(c.Era) != "" {
+		keys = append(keys, indexKey("era", c.Era))
+	}
+	if strings.TrimSpace(c.Nationality) != "" {
+		keys = append(keys, indexKey("nationality", c.Nationality))
+	}
+	if strings.TrimSpace(c.Lastname) != "" {
+		keys = append(keys, indexKey("lastname", c.Lastname))
+	}
+	for _, token := range c.SearchTokens() {
+		keys = append(keys, indexKey("token", token))
+	}
+	return keys
+}
+
+// filterIndexKeys returns the index keys that can answer the filter. It is
+// empty when the filter has no indexed condition.
+func filterIndexKeys(f composer.Filter) []string {
+	keys := []string{}
+	if f.Deleted {
+		return append(keys, trashIndexKey)
+	}
+	if f.Era != "" {
+		keys = append(keys, indexKey("era", f.Era))
+	}
+	if f.Nationality != "" {
+		keys = append(keys, indexKey("nationality", f.Nationality))
+	}
+	if f.Lastname != "" {
+		keys = append(keys, indexKey("lastname", f.Lastname))
+	}
+	for _, token := range composer.SearchTokens(f.Query) {
+		keys = append(keys, indexKey("token", token))
+	}
+	return keys
+}
+
+// addIndexEntries takes the next slot of the index key of each entry and sets
+// it, returning the slots in the order of the entries.
+func addIndexEntries(bucket store.Bucket, entries []indexEntry) ([]uint64, error) {
+	slots := make([]uint64, len(entries))
+	keyValues := []cm.Tuple[string, cm.List[uint8]]{}
+	for i, entry := range entries {
+		res := atomics.Increment(bucket, entry.key, 1)
+		if res.IsErr() {
+			return nil, newStoreError("error incrementing index counter", res.Err())
+		}
+		slots[i] = *res.OK()
+		keyValues = append(keyValues, cm.Tuple[string, cm.List[uint8]]{F0: indexEntryKey(entry.key, slots[i]), F1: cm.ToList([]byte(entry.id))})
+	}
+
+	for start := 0; start < len(keyValues); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(keyValues))
+		res := batch.SetMany(bucket, cm.ToList(keyValues[start:end]))
+		if res.IsErr() {
+			return nil, newStoreError("error setting index entries", res.Err())
+		}
+	}
+	return slots, nil
+}
+
+// deleteIndexEntries deletes the index entries stored under the entry keys.
+func deleteIndexEntries(bucket store.Bucket, entryKeys []string) error {
+	for start := 0; start < len(entryKeys); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(entryKeys))
+		res := batch.DeleteMany(bucket, cm.ToList(entryKeys[start:end]))
+		if res.IsErr() {
+			return newStoreError("error deleting index entries", res.Err())
+		}
+	}
+	return nil
+}
+
+// readIndex returns the sorted ids listed under the index key.
+func readIndex(bucket store.Bucket, key string) ([]string, error) {
+	ids := []string{}
+
+	// Get entry count
+	existsRes := bucket.Exists(key)
+	if existsRes.IsErr() {
+		return nil, newStoreError("error checking index counter", existsRes.Err())
+	} else if !*existsRes.OK() {
+		return ids, nil
+	}
+	countRes := atomics.Increment(bucket, key, 0)
+	if countRes.IsErr() {
+		return nil, newStoreError("error getting index counter", countRes.Err())
+	}
+	count := *countRes.OK()
+
+	// Get entries
+	for start := uint64(1); start <= count; start += exportBatchSize {
+		end := min(start+exportBatchSize-1, count)
+		entryKeys := []string{}
+		for n := start; n <= end; n++ {
+			entryKeys = append(entryKeys, indexEntryKey(key, n))
+		}
+		getRes := batch.GetMany(bucket, cm.ToList(entryKeys))
+		if getRes.IsErr() {
+			return nil, newStoreError("error getting index entries", getRes.Err())
+		}
+		for _, kv := range getRes.OK().Slice() {
+			if some := kv.Some(); some != nil {
+				ids = append(ids, string(some.F1.Slice()))
+			}
+		}
+	}
+
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
+// lookupIndexes returns the sorted ids present in every one of the index keys.
+func lookupIndexes(bucket store.Bucket, keys []string) ([]string, error) {
+	var ids []string
+	for i, key := range keys {
+		keyIDs, err := readIndex(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			ids = keyIDs
+			continue
+		}
+		ids = slices.DeleteFunc(ids, func(id string) bool {
+			_, found := slices.BinarySearch(keyIDs, id)
+			return !found
+		})
+	}
+	return ids, nil
+}
+
+// allKeys returns every key in the bucket, following list-keys cursors until
+// the bucket is exhausted.
+func allKeys(bucket store.Bucket) ([]string, error) {
+	keys := []string{}
+	cursor := cm.None[uint64]()
+	for {
+		res := bucket.ListKeys(cursor)
+		if res.IsErr() {
+			return nil, newStoreError("error listing keys", res.Err())
+		}
+		keys = append(keys, res.OK().Keys.Slice()...)
+
+		cursor = res.OK().Cursor
+		if cursor.None() {
+			return keys, nil
+		}
+	}
+}
+
+func rebuildIndexHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Rebuilding indexes")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// List keys
+	keys, err := allKeys(*bucket)
+	if err != nil {
+		logger.Error("Error listing keys", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Delete derived data
+	staleKeys, recordKeys := []string{}, []string{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, indexPrefix) || strings.HasPrefix(key, derivedPrefix) || strings.HasPrefix(key, statsPrefix) {
+			staleKeys = append(staleKeys, key)
+		} else if isRecordKey(key) {
+			recordKeys = append(recordKeys, key)
+		}
+	}
+	for start := 0; start < len(staleKeys); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(staleKeys))
+		delRes := batch.DeleteMany(*bucket, cm.ToList(staleKeys[start:end]))
+		if delRes.IsErr() {
+			logger.Error("Error deleting derived values", "error", delRes.Err())
+			writeError(w, r, newStoreError("error deleting derived values", delRes.Err()))
+			return
+		}
+	}
+
+	// Derive data from the primary records
+	for start := 0; start < len(recordKeys); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(recordKeys))
+		getRes := batch.GetMany(*bucket, cm.ToList(recordKeys[start:end]))
+		if getRes.IsErr() {
+			logger.Error("Error getting values", "error", getRes.Err())
+			writeError(w, r, newStoreError("error getting values", getRes.Err()))
+			return
+		}
+		changes := []recordChange{}
+		for _, kv := range getRes.OK().Slice() {
+			if some := kv.Some(); some != nil {
+				changes = append(changes, recordChange{key: some.F0, value: some.F1.Slice()})
+			}
+		}
+		err = syncDerived(*bucket, changes...)
+		if err != nil {
+			logger.Error("Error deriving data", "error", err)
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	// Read counts
+	stats, err := readStats(*bucket)
+	if err != nil {
+		logger.Error("Error reading stats", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	rebuildResponse := map[string]any{
+		"records": len(recordKeys),
+		"counts":  stats,
+		"message": "indexes rebuilt",
+	}
+	writeJSON(w, http.StatusOK, rebuildResponse)
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/batch"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+// A listing is read from the indexes whenever its filter has an indexed
+// condition: era, nationality, lastname, a query, or the trash. Otherwise the
+// key pages of the bucket are walked, examining at most maxScanKeys keys for
+// each page, so a page of a selective filter may hold fewer composers than its
+// limit, or none, and still have a next cursor. Sorting needs every composer
+// it orders, so it is only done over the composers found by an index, and
+// refused when there are more than maxSortSize of them.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	maxScanKeys     = 1000
+	maxSortSize     = 1000
+)
+
+// listCursor is the position of a listing within the bucket. Store is the
+// list-keys cursor of the current key page (absent for the first page) and
+// Offset is the index of the next key to read from that page.
+type listCursor struct {
+	Store  cm.Option[uint64]
+	Offset int
+}
+
+// encode returns the opaque form of the cursor handed out to clients.
+func (c listCursor) encode() string {
+	store := ""
+	if s := c.Store.Some(); s != nil {
+		store = strconv.FormatUint(*s, 10)
+	}
+	raw := store + ":" + strconv.Itoa(c.Offset)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor previously returned by encode. An empty string
+// is the start of the listing.
+func decodeCursor(s string) (listCursor, error) {
+	cur := listCursor{Store: cm.None[uint64]()}
+	if s == "" {
+		return cur, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, err
+	}
+	store, offset, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return cur, errors.New("malformed cursor")
+	}
+	if store != "" {
+		n, err := strconv.ParseUint(store, 10, 64)
+		if err != nil {
+			return cur, err
+		}
+		cur.Store = cm.Some(n)
+	}
+	cur.Offset, err = strconv.Atoi(offset)
+	if err != nil || cur.Offset < 0 {
+		return cur, errors.New("malformed cursor offset")
+	}
+	return cur, nil
+}
+
+type listResponse struct {
+	Composers []composer.Composer `json:"composers"`
+	Next      string              `json:"next,omitempty"`
+}
+
+func listHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing composers")
+
+	// Get page size
+	limit := defaultPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxPageSize {
+			logger.Error("Invalid limit query", "limit", l)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid limit query")
+			return
+		}
+		limit = n
+	}
+
+	// Get cursor
+	cur, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		logger.Error("Invalid cursor query", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid cursor query")
+		return
+	}
+
+	// Get filter
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		logger.Error("Invalid filter query", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid filter query")
+		return
+	}
+
+	// Get sort order
+	var sortFunc func(a, b composer.Composer) int
+	if v := r.URL.Query().Get("sort"); v != "" {
+		sortFunc, err = composer.SortFunc(v)
+		if err != nil {
+			logger.Error("Invalid sort query", "sort", v)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid sort query")
+			return
+		}
+	}
+
+	// Check an index can serve the sort
+	keys := filterIndexKeys(filter)
+	if sortFunc != nil && len(keys) == 0 {
+		logger.Error("Sort without an indexed filter")
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "sort needs an era, nationality, lastname, q or deleted filter")
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Read the page, from the indexes when the filter allows it
+	var page listResponse
+	if sortFunc != nil {
+		page, err = sortedPage(*bucket, keys, filter, sortFunc, cur, limit)
+	} else if len(keys) > 0 {
+		page, err = indexPage(*bucket, keys, filter, cur, limit)
+	} else {
+		page, err = scanPage(*bucket, filter, cur, limit)
+	}
+	if err != nil {
+		logger.Error("Error listing composers", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, page)
+}
+
+// scanPage walks the key pages of the bucket from cur until the page is full,
+// maxScanKeys keys have been examined or the bucket is exhausted.
+func scanPage(bucket store.Bucket, filter composer.Filter, cur listCursor, limit int) (listResponse, error) {
+	page := listResponse{Composers: []composer.Composer{}}
+	scanned := 0
+	for {
+		keysRes := bucket.ListKeys(cur.Store)
+		if keysRes.IsErr() {
+			return page, newStoreError("error listing keys", keysRes.Err())
+		}
+		keys := keysRes.OK().Keys.Slice()
+
+		for ; cur.Offset < len(keys) && len(page.Composers) < limit && scanned < maxScanKeys; cur.Offset++ {
+			scanned++
+			if !isComposerKey(keys[cur.Offset]) {
+				continue
+			}
+			comp, ok, err := getComposer(bucket, keys[cur.Offset])
+			if err != nil {
+				return page, err
+			} else if !ok || !filter.Match(comp) {
+				continue
+			}
+			page.Composers = append(page.Composers, comp)
+		}
+
+		if cur.Offset < len(keys) {
+			page.Next = cur.encode()
+			return page, nil
+		}
+		next := keysRes.OK().Cursor
+		if next.None() {
+			return page, nil
+		}
+		cur = listCursor{Store: next}
+		if len(page.Composers) == limit || scanned == maxScanKeys {
+			page.Next = cur.encode()
+			return page, nil
+		}
+	}
+}
+
+// scanKeys walks the key pages of the bucket from cur, collecting up to limit
+// of the keys which match. It returns them with the cursor of the rest of the
+// listing, which is empty once the bucket is exhausted.
+func scanKeys(bucket store.Bucket, cur listCursor, limit int, match func(key string) bool) ([]string, string, error) {
+	matched := []string{}
+	for {
+		keysRes := bucket.ListKeys(cur.Store)
+		if keysRes.IsErr() {
+			return matched, "", newStoreError("error listing keys", keysRes.Err())
+		}
+		keys := keysRes.OK().Keys.Slice()
+
+		for ; cur.Offset < len(keys) && len(matched) < limit; cur.Offset++ {
+			if match(keys[cur.Offset]) {
+				matched = append(matched, keys[cur.Offset])
+			}
+		}
+
+		if cur.Offset < len(keys) {
+			return matched, cur.encode(), nil
+		}
+		next := keysRes.OK().Cursor
+		if next.None() {
+			return matched, "", nil
+		}
+		cur = listCursor{Store: next}
+		if len(matched) == limit {
+			return matched, cur.encode(), nil
+		}
+	}
+}
+
+// indexPage reads the composers listed under every one of the index keys,
+// starting at the offset of cur.
+func indexPage(bucket store.Bucket, keys []string, filter composer.Filter, cur listCursor, limit int) (listResponse, error) {
+	page := listResponse{Composers: []composer.Composer{}}
+
+	ids, err := lookupIndexes(bucket, keys)
+	if err != nil {
+		return page, err
+	}
+
+	for ; cur.Offset < len(ids) && len(page.Composers) < limit; cur.Offset++ {
+		comp, ok, err := getComposer(bucket, ids[cur.Offset])
+		if err != nil {
+			return page, err
+		} else if !ok || !filter.Match(comp) {
+			continue
+		}
+		page.Composers = append(page.Composers, comp)
+	}
+
+	if cur.Offset < len(ids) {
+		page.Next = cur.encode()
+	}
+	return page, nil
+}
+
+// sortedPage reads every composer listed under all of the index keys which
+// matches the filter, and returns the page at the offset of cur once sorted.
+func sortedPage(bucket store.Bucket, keys []string, filter composer.Filter, sortFunc func(a, b composer.Composer) int, cur listCursor, limit int) (listResponse, error) {
+	page := listResponse{Composers: []composer.Composer{}}
+
+	ids, err := lookupIndexes(bucket, keys)
+	if err != nil {
+		return page, err
+	} else if len(ids) > maxSortSize {
+		return page, problem.New(http.StatusBadRequest, problem.CodeBadRequest, "too many composers to sort, narrow the filter")
+	}
+
+	comps := []composer.Composer{}
+	for start := 0; start < len(ids); start += exportBatchSize {
+		end := min(start+exportBatchSize, len(ids))
+		getRes := batch.GetMany(bucket, cm.ToList(ids[start:end]))
+		if getRes.IsErr() {
+			return page, newStoreError("error getting values", getRes.Err())
+		}
+		for _, kv := range getRes.OK().Slice() {
+			some := kv.Some()
+			if some == nil {
+				continue
+			}
+			comp := composer.Composer{}
+			err = json.Unmarshal(some.F1.Slice(), &comp)
+			if err != nil {
+				return page, err
+			} else if filter.Match(comp) {
+				comps = append(comps, comp)
+			}
+		}
+	}
+	slices.SortStableFunc(comps, sortFunc)
+
+	if cur.Offset < len(comps) {
+		end := min(cur.Offset+limit, len(comps))
+		page.Composers = comps[cur.Offset:end]
+		if end < len(comps) {
+			page.Next = listCursor{Store: cm.None[uint64](), Offset: end}.encode()
+		}
+	}
+	return page, nil
+}
+
+// parseFilter reads the composer filter from the listing query parameters.
+func parseFilter(q url.Values) (composer.Filter, error) {
+	filter := composer.Filter{
+		Era:         q.Get("era"),
+		Nationality: q.Get("nationality"),
+		Lastname:    q.Get("lastname"),
+		Name:        q.Get("name"),
+		Query:       q.Get("q"),
+	}
+
+	var err error
+	if v := q.Get("deleted"); v != "" {
+		filter.Deleted, err = strconv.ParseBool(v)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if v := q.Get("bornAfter"); v != "" {
+		date, err := composer.ParseHistoricalDate(v)
+		if err != nil {
+			return filter, err
+		}
+		// The bounds are exclusive, so a composer born after 1685 must be
+		// born after the last day 1685 may refer to
+		filter.BornAfter = date.Latest
+	}
+	if v := q.Get("diedBefore"); v != "" {
+		date, err := composer.ParseHistoricalDate(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.DiedBefore = date.Earliest
+	}
+	return filter, nil
+}
@@ -11,28 +11,62 @@ const (
 	componentName = "composer"
 )
 
-var logger = wasilog.ContextLogger("composer")
+var (
+	logger = wasilog.ContextLogger("composer")
+	routes = newRouter()
+)
 
 func init() {
+	routes.handle(http.MethodGet, "/composers", listHandler)
+	routes.handle(http.MethodPost, "/composers", createHandler)
+	routes.handle(http.MethodPost, "/composers:purge", purgeHandler)
+	routes.handle(http.MethodPost, "/composers:import", importHandler)
+	routes.handle(http.MethodGet, "/composers:export", exportHandler(composerExport))
+	routes.handle(http.MethodGet, "/composers/{id}", readHandler)
+	routes.handle(http.MethodPut, "/composers/{id}", updateHandler)
+	routes.handle(http.MethodPatch, "/composers/{id}", patchHandler)
+	routes.handle(http.MethodDelete, "/composers/{id}", deleteHandler)
+	routes.handle(http.MethodPost, "/composers/{id}:restore", restoreHandler)
+	routes.handle(http.MethodGet, "/composers/{id}/history", historyHandler)
+	routes.handle(http.MethodGet, "/composers/{id}/history/{revision}", historyEntryHandler)
+	routes.handle(http.MethodPost, "/composers/{id}/history/{revision}:revert", revertHandler)
+	routes.handle(http.MethodGet, "/composers/{id}/works", composerWorksHandler)
+	works.register(routes)
+	routes.handle(http.MethodGet, "/works:export", exportHandler(workExport))
+	routes.handle(http.MethodGet, "/works/{id}/recordings", linkedRecordingsHandler("work", "work-recordings", works.exists))
+	routes.handle(http.MethodGet, "/catalogue/{scheme}/{number...}", catalogueHandler)
+	performers.register(routes)
+	routes.handle(http.MethodGet, "/performers/{id}/recordings", linkedRecordingsHandler("performer", "performer-recordings", performers.exists))
+	ensembles.register(routes)
+	routes.handle(http.MethodGet, "/ensembles/{id}/recordings", linkedRecordingsHandler("ensemble", "ensemble-recordings", ensembles.exists))
+	recordings.register(routes)
+	routes.handle(http.MethodGet, "/recordings/{id}/works", recordingWorksHandler)
+	routes.handle(http.MethodGet, "/recordings/{id}/credits", recordingCreditsHandler)
+	routes.handle(http.MethodGet, "/webhooks", listWebhooksHandler)
+	routes.handle(http.MethodPost, "/webhooks", createWebhookHandler)
+	routes.handle(http.MethodPost, "/webhooks:retry", retryWebhooksHandler)
+	routes.handle(http.MethodGet, "/webhooks/{id}", readWebhookHandler)
+	routes.handle(http.MethodPut, "/webhooks/{id}", updateWebhookHandler)
+	routes.handle(http.MethodDelete, "/webhooks/{id}", deleteWebhookHandler)
+	routes.handle(http.MethodGet, "/webhooks/{id}/deliveries", webhookDeliveriesHandler)
+	routes.handle(http.MethodGet, "/webhooks/{id}/dead-letters", deadLettersHandler)
+	routes.handle(http.MethodPost, "/webhooks/{id}/dead-letters/{delivery}:redeliver", redeliverHandler)
+	routes.handle(http.MethodGet, "/stats", statsHandler)
+	routes.handle(http.MethodPost, "/admin/indexes:rebuild", rebuildIndexHandler)
+
 	wasihttp.HandleFunc(handler)
 }
 
 func handler(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Handling request", "request", r)
-	switch r.Method {
-	case http.MethodGet:
-		readHandler(w, r)
-	case http.MethodPost:
-		createHandler(w, r)
-	case http.MethodPut:
-		updateHandler(w, r)
-	case http.MethodDelete:
-		deleteHandler(w, r)
-	default:
-		logger.Error("Method not allowed", "method", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	setRequestID(w, r)
+	logger.Info("Handling request", "method", r.Method, "path", r.URL.Path, "requestId", r.Header.Get(requestIDHeader))
+
+	r.URL.Path = routes.resolve(configValue(configPathPrefix, ""), r.URL.Path)
+	r, ok := authorize(w, r)
+	if !ok {
 		return
 	}
+	routes.ServeHTTP(w, r)
 }
 
 //go:generate wit-bindgen-go generate --world function --out gen ./wit
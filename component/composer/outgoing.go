@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	monotonicclock "github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/clocks/monotonic-clock"
+	outgoinghandler "github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/http/outgoing-handler"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/http/types"
+)
+
+const (
+	// maxStreamWrite is the most a blocking write to an output stream may
+	// carry at once.
+	maxStreamWrite = 4096
+)
+
+// post sends body as a POST to rawURL through wasi:http/outgoing-handler,
+// returning the status of the response. The timeout bounds both connecting
+// and waiting for the first byte of the response.
+func post(rawURL string, header http.Header, body []byte, timeout time.Duration) (int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build headers
+	fields := types.NewFields()
+	for name, values := range header {
+		for _, value := range values {
+			res := fields.Append(types.FieldKey(strings.ToLower(name)), types.FieldValue(cm.ToList([]byte(value))))
+			if res.IsErr() {
+				fields.ResourceDrop()
+				return 0, fmt.Errorf("error setting header %s: %s", name, res.Err())
+			}
+		}
+	}
+
+	// Build request
+	req := types.NewOutgoingRequest(fields)
+	scheme := types.SchemeHTTPS()
+	if u.Scheme == "http" {
+		scheme = types.SchemeHTTP()
+	}
+	if req.SetMethod(types.MethodPost()) ||
+		req.SetScheme(cm.Some(scheme)) ||
+		req.SetAuthority(cm.Some(u.Host)) ||
+		req.SetPathWithQuery(cm.Some(u.RequestURI())) {
+		req.ResourceDrop()
+		return 0, errors.New("error building request for " + u.Redacted())
+	}
+
+	// Write body
+	bodyRes := req.Body()
+	if bodyRes.IsErr() {
+		req.ResourceDrop()
+		return 0, errors.New("error getting request body")
+	}
+	outBody := *bodyRes.OK()
+	err = writeBody(outBody, body)
+	if err != nil {
+		outBody.ResourceDrop()
+		req.ResourceDrop()
+		return 0, err
+	}
+
+	// Send request
+	options := types.NewRequestOptions()
+	wait := cm.Some(monotonicclock.Duration(timeout.Nanoseconds()))
+	options.SetConnectTimeout(wait)
+	options.SetFirstByteTimeout(wait)
+	handleRes := outgoinghandler.Handle(req, cm.Some(options))
+	if handleRes.IsErr() {
+		outBody.ResourceDrop()
+		return 0, errorCode(*handleRes.Err())
+	}
+	future := *handleRes.OK()
+	defer future.ResourceDrop()
+
+	finishRes := types.OutgoingBodyFinish(outBody, cm.None[types.Fields]())
+	if finishRes.IsErr() {
+		return 0, errorCode(*finishRes.Err())
+	}
+
+	// Wait for response
+	pollable := future.Subscribe()
+	pollable.Block()
+	pollable.ResourceDrop()
+
+	got := future.Get()
+	getRes := got.Some()
+	if getRes == nil || getRes.IsErr() {
+		return 0, errors.New("error getting response")
+	}
+	respRes := getRes.OK()
+	if respRes.IsErr() {
+		return 0, errorCode(*respRes.Err())
+	}
+	resp := *respRes.OK()
+	defer resp.ResourceDrop()
+
+	return int(resp.Status()), nil
+}
+
+// writeBody writes body to the outgoing body's stream in pieces no larger
+// than a blocking write allows.
+func writeBody(outBody types.OutgoingBody, body []byte) error {
+	streamRes := outBody.Write()
+	if streamRes.IsErr() {
+		return errors.New("error getting request body stream")
+	}
+	stream := *streamRes.OK()
+	defer stream.ResourceDrop()
+
+	for len(body) > 0 {
+		n := min(len(body), maxStreamWrite)
+		res := stream.BlockingWriteAndFlush(cm.ToList(body[:n]))
+		if res.IsErr() {
+			return errors.New("error writing request body")
+		}
+		body = body[n:]
+	}
+	return nil
+}
+
+// errorCode describes an outgoing request error. The error codes have no
+// text of their own, so only their case is reported.
+func errorCode(code types.ErrorCode) error {
+	return fmt.Errorf("http request failed with error code %d", code.Tag())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+)
+
+// etag returns the strong entity tag of the composer's current revision.
+func etag(c composer.Composer) string {
+	return revisionTag(c.Revision)
+}
+
+// revisionTag returns the strong entity tag of a revision.
+func revisionTag(revision uint64) string {
+	return `"` + strconv.FormatUint(revision, 10) + `"`
+}
+
+// Reads may be kept for a short time before being revalidated with the ETag.
+// A read the access policy allows without credentials is the same for every
+// caller, so shared caches such as CDNs may keep it too. Any other read
+// depends on the credentials of the request, so only the client may keep it.
+const (
+	publicCacheControl  = "public, max-age=60, s-maxage=60"
+	privateCacheControl = "private, max-age=60"
+)
+
+// setCacheHeaders sets the caching headers of a read of resource.
+func setCacheHeaders(w http.ResponseWriter, resource string) {
+	if publicRead(resource) {
+		w.Header().Set("Cache-Control", publicCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", privateCacheControl)
+	}
+	w.Header().Set("Vary", "Authorization, "+apiKeyHeader)
+}
+
+// setValidators sets the ETag and Last-Modified headers of the composer.
+func setValidators(w http.ResponseWriter, c composer.Composer) {
+	setRevisionValidators(w, c.Revision, c.UpdatedAt)
+}
+
+// setRevisionValidators sets the ETag and Last-Modified headers of a resource
+// at the given revision.
+func setRevisionValidators(w http.ResponseWriter, revision uint64, updatedAt time.Time) {
+	w.Header().Set("ETag", revisionTag(revision))
+	if !updatedAt.IsZero() {
+		w.Header().Set("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// ifMatch reports whether the request's If-Match header allows a write to a
+// resource with the given entity tag. Requests without the header always
+// match. Weak tags never match as If-Match requires strong comparison.
+//
+// wasi:keyvalue has no compare-and-swap, so the check narrows rather than
+// closes the window between reading a composer and writing it back.
+func ifMatch(r *http.Request, tag string) bool {
+	header := strings.Join(r.Header.Values("If-Match"), ",")
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether a read of a resource with the given entity tag
+// and modification time can be answered with 304 Not Modified. As in RFC 9110,
+// If-Modified-Since is ignored when If-None-Match is present.
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	header := strings.Join(r.Header.Values("If-None-Match"), ",")
+	if header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+	"github.com/jamesstocktonj1/mulib/pkg/recording"
+)
+
+// Recordings link to works and to performers and ensembles by their credits.
+// Each link is indexed in reverse, under "idx:work-recordings:<work id>",
+// "idx:performer-recordings:<performer id>" and
+// "idx:ensemble-recordings:<ensemble id>", so that the links can be followed
+// from either end. Works, performers and ensembles can't be deleted while a
+// recording links to them.
+var (
+	performers = &resource[recording.Performer, *recording.Performer]{
+		name:   "performer",
+		plural: "performers",
+		prefix: "performer:",
+		inUse:  linkedFrom("performer-recordings"),
+	}
+
+	ensembles = &resource[recording.Ensemble, *recording.Ensemble]{
+		name:   "ensemble",
+		plural: "ensembles",
+		prefix: "ensemble:",
+		inUse:  linkedFrom("ensemble-recordings"),
+	}
+
+	recordings = &resource[recording.Recording, *recording.Recording]{
+		name:       "recording",
+		plural:     "recordings",
+		prefix:     "recording:",
+		indexKeys:  recordingIndexKeys,
+		checkLinks: checkRecordingLinks,
+	}
+)
+
+// recordingIndexKeys returns the index keys a recording should be listed
+// under.
+func recordingIndexKeys(rec recording.Recording) []string {
+	keys := []string{}
+	for _, id := range rec.WorkIDs {
+		keys = append(keys, indexKey("work-recordings", id))
+	}
+	for _, credit := range rec.Credits {
+		if credit.PerformerID != "" {
+			keys = append(keys, indexKey("performer-recordings", credit.PerformerID))
+		}
+		if credit.EnsembleID != "" {
+			keys = append(keys, indexKey("ensemble-recordings", credit.EnsembleID))
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// checkRecordingLinks checks that every work, performer and ensemble linked
+// from the recording exists.
+func checkRecordingLinks(bucket store.Bucket, rec recording.Recording) error {
+	verr := &recording.ValidationError{}
+	missing := func(field, message string) {
+		verr.Fields = append(verr.Fields, composer.FieldError{Field: field, Message: message})
+	}
+
+	for i, id := range rec.WorkIDs {
+		ok, err := works.exists(bucket, id)
+		if err != nil {
+			return err
+		} else if !ok {
+			missing(fmt.Sprintf("workIds[%d]", i), "work does not exist")
+		}
+	}
+	for i, credit := range rec.Credits {
+		field := fmt.Sprintf("credits[%d]", i)
+		if credit.PerformerID != "" {
+			ok, err := performers.exists(bucket, credit.PerformerID)
+			if err != nil {
+				return err
+			} else if !ok {
+				missing(field+".performerId", "performer does not exist")
+			}
+		}
+		if credit.EnsembleID != "" {
+			ok, err := ensembles.exists(bucket, credit.EnsembleID)
+			if err != nil {
+				return err
+			} else if !ok {
+				missing(field+".ensembleId", "ensemble does not exist")
+			}
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// linkedFrom returns a check of whether any recording is listed under the id
+// in the given reverse index.
+func linkedFrom(field string) func(bucket store.Bucket, id string) (bool, error) {
+	return func(bucket store.Bucket, id string) (bool, error) {
+		ids, err := readIndex(bucket, indexKey(field, id))
+		return len(ids) > 0, err
+	}
+}
+
+// linkedRecordingsHandler returns a handler listing the recordings under the
+// reverse index field for the path id, once exists has confirmed the record
+// at the other end of the link.
+func linkedRecordingsHandler(name, field string, exists func(bucket store.Bucket, id string) (bool, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.Info("Listing " + name + " recordings")
+
+		// Get ID
+		id := r.PathValue("id")
+
+		// Get page size
+		limit := defaultPageSize
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 || n > maxPageSize {
+				logger.Error("Invalid limit query", "limit", l)
+				writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid limit query")
+				return
+			}
+			limit = n
+		}
+
+		// Get cursor
+		cur, err := decodeCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			logger.Error("Invalid cursor query", "error", err)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid cursor query")
+			return
+		}
+
+		// Open bucket
+		bucketRes := store.Open(componentName)
+		if bucketRes.IsErr() {
+			logger.Error("Error opening bucket", "error", bucketRes.Err())
+			writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+			return
+		}
+		bucket := bucketRes.OK()
+
+		// Check value exists
+		ok, err := exists(*bucket, id)
+		if err != nil {
+			logger.Error("Error getting value", "error", err)
+			writeError(w, r, err)
+			return
+		} else if !ok {
+			logger.Error("Value does not exist", "id", id)
+			writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, name+" does not exist")
+			return
+		}
+
+		// Read index
+		ids, err := readIndex(*bucket, indexKey(field, id))
+		if err != nil {
+			logger.Error("Error reading index", "id", id, "error", err)
+			writeError(w, r, err)
+			return
+		}
+
+		// Read page
+		page, err := recordings.page(*bucket, ids, cur, limit)
+		if err != nil {
+			logger.Error("Error listing recordings", "error", err)
+			writeError(w, r, err)
+			return
+		}
+
+		// Write response
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func recordingWorksHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing recording works")
+
+	// Get recording ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get recording
+	rec, ok, err := recordings.get(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "recording does not exist")
+		return
+	}
+
+	// Read works
+	page, err := worksPage(*bucket, rec.WorkIDs, listCursor{Store: cm.None[uint64]()}, len(rec.WorkIDs))
+	if err != nil {
+		logger.Error("Error listing works", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, page)
+}
+
+// creditResponse is a recording credit with the performer or ensemble it
+// links to.
+type creditResponse struct {
+	Role      recording.Role       `json:"role"`
+	Performer *recording.Performer `json:"performer,omitempty"`
+	Ensemble  *recording.Ensemble  `json:"ensemble,omitempty"`
+}
+
+func recordingCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing recording credits")
+
+	// Get recording ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get recording
+	rec, ok, err := recordings.get(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "recording does not exist")
+		return
+	}
+
+	// Resolve credits
+	credits := []creditResponse{}
+	for _, credit := range rec.Credits {
+		resp := creditResponse{Role: credit.Role}
+		if credit.PerformerID != "" {
+			p, ok, err := performers.get(*bucket, credit.PerformerID)
+			if err != nil {
+				logger.Error("Error getting value", "error", err)
+				writeError(w, r, err)
+				return
+			} else if ok {
+				resp.Performer = &p
+			}
+		}
+		if credit.EnsembleID != "" {
+			e, ok, err := ensembles.get(*bucket, credit.EnsembleID)
+			if err != nil {
+				logger.Error("Error getting value", "error", err)
+				writeError(w, r, err)
+				return
+			} else if ok {
+				resp.Ensemble = &e
+			}
+		}
+		credits = append(credits, resp)
+	}
+
+	// Write response
+	creditsResponse := map[string]any{
+		"credits": credits,
+	}
+	writeJSON(w, http.StatusOK, creditsResponse)
+}
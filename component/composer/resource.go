@@ -0,0 +1,614 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
+	"github.com/jamesstocktonj1/mulib/pkg/cloudevents"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+	"github.com/jamesstocktonj1/mulib/pkg/record"
+)
+
+// recordPointer is implemented by pointers to the records served by a resource.
+type recordPointer[T any] interface {
+	*T
+	Metadata() *record.Meta
+	Validate() error
+}
+
+// resource serves the CRUD routes of a record type which has no trash, storing
+// each record in the composer bucket under "<prefix><id>". Works, performers,
+// ensembles and recordings are served this way.
+//
+// As for composers, every write is recorded in the history, under
+// "hist:<prefix><id>:<revision>", and published as a "<name>.<action>" event.
+// Writes are checked against the principal's rules for the resource named by
+// the plural, including the fields they change. A record is deleted outright,
+// along with its history.
+type resource[T any, P recordPointer[T]] struct {
+	name   string
+	plural string
+	prefix string
+
+	// indexKeys returns the index keys a record is listed under. It may be
+	// nil when the record isn't indexed.
+	indexKeys func(v T) []string
+
+	// checkLinks checks that the records linked from v exist, returning a
+	// validation error if not. It may be nil.
+	checkLinks func(bucket store.Bucket, v T) error
+
+	// inUse reports whether other records link to the record, in which case
+	// it can't be deleted. It may be nil.
+	inUse func(bucket store.Bucket, id string) (bool, error)
+}
+
+// register adds the collection and item routes of the resource to rt.
+func (res *resource[T, P]) register(rt *router) {
+	rt.handle(http.MethodGet, "/"+res.plural, res.list)
+	rt.handle(http.MethodPost, "/"+res.plural, res.create)
+	rt.handle(http.MethodGet, "/"+res.plural+"/{id}", res.read)
+	rt.handle(http.MethodPut, "/"+res.plural+"/{id}", res.update)
+	rt.handle(http.MethodDelete, "/"+res.plural+"/{id}", res.delete)
+	rt.handle(http.MethodGet, "/"+res.plural+"/{id}/history", res.history)
+}
+
+func (res *resource[T, P]) key(id string) string {
+	return res.prefix + id
+}
+
+func (res *resource[T, P]) list(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing " + res.plural)
+
+	// Get page size
+	limit := defaultPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxPageSize {
+			logger.Error("Invalid limit query", "limit", l)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid limit query")
+			return
+		}
+		limit = n
+	}
+
+	// Get cursor
+	cur, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		logger.Error("Invalid cursor query", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid cursor query")
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// List keys
+	keys, next, err := scanKeys(*bucket, cur, limit, func(key string) bool {
+		return strings.HasPrefix(key, res.prefix)
+	})
+	if err != nil {
+		logger.Error("Error listing keys", "error", err)
+		writeError(w, r, err)
+		return
+	}
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = strings.TrimPrefix(key, res.prefix)
+	}
+
+	// Read page
+	page, err := res.page(*bucket, ids, listCursor{}, limit)
+	if err != nil {
+		logger.Error("Error listing "+res.plural, "error", err)
+		writeError(w, r, err)
+		return
+	}
+	if next != "" {
+		page["next"] = next
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (res *resource[T, P]) create(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Creating new " + res.name)
+
+	// Unmarshal request
+	var v T
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		logger.Error("Error decoding request", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Set ID
+	*P(&v).Metadata() = record.Meta{ID: uuid.New().String()}
+
+	// Check permission
+	var zero T
+	err = principal(r).Check(res.plural, auth.ActionCreate, composer.ChangedFields(zero, v))
+	if err != nil {
+		logger.Error("Principal may not create "+res.name, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Validate value
+	err = res.validate(*bucket, v)
+	if err != nil {
+		logger.Error("Invalid "+res.name, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Set value
+	v, err = res.put(*bucket, actor(r), composer.ActionCreated, nil, v)
+	if err != nil {
+		logger.Error("Error setting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	meta := P(&v).Metadata()
+	idResponse := map[string]string{
+		"id":      meta.ID,
+		"message": res.name + " created",
+	}
+	w.Header().Set("Location", publicPath("/"+res.plural+"/"+meta.ID))
+	setRevisionValidators(w, meta.Revision, meta.UpdatedAt)
+	writeJSON(w, http.StatusCreated, idResponse)
+}
+
+func (res *resource[T, P]) read(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Reading " + res.name)
+
+	// Get ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	v, ok, err := res.get(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, res.name+" does not exist")
+		return
+	}
+
+	// Check precondition
+	meta := P(&v).Metadata()
+	setRevisionValidators(w, meta.Revision, meta.UpdatedAt)
+	setCacheHeaders(w, res.plural)
+	if notModified(r, revisionTag(meta.Revision), meta.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (res *resource[T, P]) update(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Updating " + res.name)
+
+	// Get ID
+	id := r.PathValue("id")
+
+	// Unmarshal request
+	var next T
+	err := json.NewDecoder(r.Body).Decode(&next)
+	if err != nil {
+		logger.Error("Error decoding request", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	v, ok, err := res.get(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, res.name+" does not exist")
+		return
+	}
+
+	// Check precondition
+	tag := revisionTag(P(&v).Metadata().Revision)
+	if !ifMatch(r, tag) {
+		logger.Error("Revision does not match", "id", id, "etag", tag)
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "revision does not match")
+		return
+	}
+
+	// Replace value, keeping the server managed fields
+	before := v
+	*P(&next).Metadata() = *P(&v).Metadata()
+	v = next
+
+	// Check permission
+	err = principal(r).Check(res.plural, auth.ActionUpdate, composer.ChangedFields(before, v))
+	if err != nil {
+		logger.Error("Principal may not change "+res.name, "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Validate value
+	err = res.validate(*bucket, v)
+	if err != nil {
+		logger.Error("Invalid "+res.name, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Set value
+	v, err = res.put(*bucket, actor(r), composer.ActionUpdated, &before, v)
+	if err != nil {
+		logger.Error("Error setting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	meta := P(&v).Metadata()
+	setRevisionValidators(w, meta.Revision, meta.UpdatedAt)
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (res *resource[T, P]) delete(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Deleting " + res.name)
+
+	// Get ID
+	id := r.PathValue("id")
+
+	// Check permission
+	err := principal(r).Check(res.plural, auth.ActionDelete, nil)
+	if err != nil {
+		logger.Error("Principal may not delete "+res.name, "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	v, ok, err := res.get(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, res.name+" does not exist")
+		return
+	}
+
+	// Check precondition
+	tag := revisionTag(P(&v).Metadata().Revision)
+	if !ifMatch(r, tag) {
+		logger.Error("Revision does not match", "id", id, "etag", tag)
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "revision does not match")
+		return
+	}
+
+	// Check links
+	if res.inUse != nil {
+		used, err := res.inUse(*bucket, id)
+		if err != nil {
+			logger.Error("Error reading index", "id", id, "error", err)
+			writeError(w, r, err)
+			return
+		} else if used {
+			logger.Error("Value is in use", "id", id)
+			writeProblem(w, r, http.StatusConflict, problem.CodeConflict, res.name+" is linked from recordings")
+			return
+		}
+	}
+
+	// Delete value
+	delRes := bucket.Delete(res.key(id))
+	if delRes.IsErr() {
+		logger.Error("Error deleting value", "error", delRes.Err())
+		writeError(w, r, newStoreError("error deleting value", delRes.Err()))
+		return
+	}
+
+	// Delete history
+	err = deleteHistory(*bucket, res.key(id), P(&v).Metadata().Revision)
+	if err != nil {
+		logger.Error("Error deleting history", "id", id, "error", err)
+	}
+
+	// Publish event
+	res.publishEvent(*bucket, actor(r), composer.ActionDeleted, &v, nil)
+
+	// Write response
+	idResponse := map[string]string{
+		"id":      id,
+		"message": res.name + " deleted",
+	}
+	writeJSON(w, http.StatusOK, idResponse)
+}
+
+func (res *resource[T, P]) history(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Reading " + res.name + " history")
+
+	// Get ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	v, ok, err := res.get(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, res.name+" does not exist")
+		return
+	}
+
+	// Get history, newest first
+	entries := []record.HistoryEntry[T]{}
+	for rev := P(&v).Metadata().Revision; rev > 0; rev-- {
+		entry, ok, err := res.getHistory(*bucket, id, rev)
+		if err != nil {
+			logger.Error("Error getting history", "id", id, "revision", rev, "error", err)
+			writeError(w, r, err)
+			return
+		} else if !ok {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	// Write response
+	historyResponse := map[string]any{
+		"id":      id,
+		"history": entries,
+	}
+	writeJSON(w, http.StatusOK, historyResponse)
+}
+
+// page reads the records with the given ids, starting at the offset of cur,
+// into a response listing them under the plural name of the resource.
+func (res *resource[T, P]) page(bucket store.Bucket, ids []string, cur listCursor, limit int) (map[string]any, error) {
+	items := []T{}
+	for ; cur.Offset < len(ids) && len(items) < limit; cur.Offset++ {
+		v, ok, err := res.get(bucket, ids[cur.Offset])
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		items = append(items, v)
+	}
+
+	page := map[string]any{res.plural: items}
+	if cur.Offset < len(ids) {
+		page["next"] = cur.encode()
+	}
+	return page, nil
+}
+
+func (res *resource[T, P]) validate(bucket store.Bucket, v T) error {
+	err := P(&v).Validate()
+	if err != nil || res.checkLinks == nil {
+		return err
+	}
+	return res.checkLinks(bucket, v)
+}
+
+// get reads and decodes the record stored for id. The boolean result is false
+// when there is no such record.
+func (res *resource[T, P]) get(bucket store.Bucket, id string) (T, bool, error) {
+	var v T
+
+	getRes := bucket.Get(res.key(id))
+	if getRes.IsErr() {
+		return v, false, newStoreError("error getting value", getRes.Err())
+	}
+	value := getRes.OK().Some()
+	if value == nil {
+		return v, false, nil
+	}
+
+	err := json.Unmarshal(value.Slice(), &v)
+	if err != nil {
+		return v, false, err
+	}
+	return v, true, nil
+}
+
+// getHistory reads the history entry of the record for revision. The boolean
+// result is false when there is no such entry.
+func (res *resource[T, P]) getHistory(bucket store.Bucket, id string, revision uint64) (record.HistoryEntry[T], bool, error) {
+	entry := record.HistoryEntry[T]{}
+
+	getRes := bucket.Get(historyKey(res.key(id), revision))
+	if getRes.IsErr() {
+		return entry, false, newStoreError("error getting history value", getRes.Err())
+	}
+	value := getRes.OK().Some()
+	if value == nil {
+		return entry, false, nil
+	}
+
+	err := json.Unmarshal(value.Slice(), &entry)
+	if err != nil {
+		return entry, false, err
+	}
+	return entry, true, nil
+}
+
+// exists reports whether there is a record stored for id.
+func (res *resource[T, P]) exists(bucket store.Bucket, id string) (bool, error) {
+	existsRes := bucket.Exists(res.key(id))
+	if existsRes.IsErr() {
+		return false, newStoreError("error checking if value exists", existsRes.Err())
+	}
+	return *existsRes.OK(), nil
+}
+
+// put writes the next revision of v, records it in the history and publishes
+// the change from before, which is nil for a new record. It returns the record
+// as stored.
+func (res *resource[T, P]) put(bucket store.Bucket, actor, action string, before *T, v T) (T, error) {
+	meta := P(&v).Metadata()
+	meta.Revision++
+	meta.UpdatedAt = now()
+
+	// Set history before the value so that no revision goes unrecorded
+	var zero T
+	from := &zero
+	if before != nil {
+		from = before
+	}
+	entry := record.HistoryEntry[T]{
+		Revision:  meta.Revision,
+		Action:    action,
+		ChangedBy: actor,
+		ChangedAt: meta.UpdatedAt,
+		Changes:   composer.DiffValues(*from, v),
+		Record:    v,
+	}
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return v, err
+	}
+	histRes := bucket.Set(historyKey(res.key(meta.ID), meta.Revision), cm.ToList(entryBytes))
+	if histRes.IsErr() {
+		return v, newStoreError("error setting history value", histRes.Err())
+	}
+
+	// Marshal value
+	vBytes, err := json.Marshal(v)
+	if err != nil {
+		return v, err
+	}
+
+	// Set value
+	setRes := bucket.Set(res.key(meta.ID), cm.ToList(vBytes))
+	if setRes.IsErr() {
+		return v, newStoreError("error setting value", setRes.Err())
+	}
+
+	// Publish event
+	res.publishEvent(bucket, actor, action, before, &v)
+	return v, nil
+}
+
+// publishEvent publishes the event for a write which changed the record from
+// before to after. before is nil for a new record, and after for a deleted
+// one.
+func (res *resource[T, P]) publishEvent(bucket store.Bucket, actor, action string, before, after *T) {
+	data := record.Event[T]{
+		Action:    action,
+		ChangedBy: actor,
+		ChangedAt: now(),
+		Before:    before,
+		After:     after,
+	}
+	if after != nil {
+		meta := P(after).Metadata()
+		data.ID, data.Revision, data.ChangedAt = meta.ID, meta.Revision, meta.UpdatedAt
+	} else if before != nil {
+		meta := P(before).Metadata()
+		data.ID, data.Revision = meta.ID, meta.Revision
+	}
+
+	eventType := record.EventType(res.name, action)
+	schema := "urn:mulib:schema:" + res.name + "-event:1"
+	event, err := cloudevents.New(componentName, eventType, data.ID, now(), schema, data)
+	if err != nil {
+		logger.Error("Error creating event", "action", action, "id", data.ID, "error", err)
+		return
+	}
+	publishEvent(bucket, event)
+}
+
+// derive returns the data derived from value stored at key, which is nothing
+// once the record has been deleted.
+func (res *resource[T, P]) derive(key string, value []byte) (derivation, error) {
+	d := derivation{ID: strings.TrimPrefix(key, res.prefix)}
+	if value == nil {
+		return d, nil
+	}
+
+	var v T
+	err := json.Unmarshal(value, &v)
+	if err != nil {
+		return d, err
+	}
+
+	if res.indexKeys != nil {
+		d.Indexes = res.indexKeys(v)
+	}
+	d.Counters = []string{res.plural}
+	return d, nil
+}
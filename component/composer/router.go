@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+// router dispatches requests on their path and method.
+//
+// Patterns are split into slash separated segments. A segment of the form
+// "{name}" matches any single segment and is exposed to handlers through
+// r.PathValue(name). A wildcard may be followed by a literal suffix, such as
+// "{id}:restore", for custom methods on a resource. Plain wildcards never match
+// a segment containing ':' so that custom methods don't shadow the resource
+// itself. A final segment of the form "{name...}" matches the remainder of the
+// path, including any ':' or '/'. Routes are matched in the order they are
+// registered.
+type router struct {
+	routes []*route
+}
+
+type route struct {
+	pattern  string
+	segments []string
+	methods  map[string]http.HandlerFunc
+}
+
+func newRouter() *router {
+	return &router{}
+}
+
+// resolve returns the path to route for a request to path when the component
+// is mounted under prefix, the path of its HTTP link. The prefix is stripped
+// when what follows it is a route of its own, so that every resource is
+// served beneath the mount path. Otherwise the path is routed whole, so that
+// the resource the prefix names, "/composers", keeps its existing URLs.
+func (rt *router) resolve(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	rest, ok := strings.CutPrefix(path, prefix+"/")
+	if prefix == "" || !ok {
+		return path
+	}
+	segments := splitPath(rest)
+	for _, rte := range rt.routes {
+		if _, ok := rte.match(segments); ok {
+			return "/" + rest
+		}
+	}
+	return path
+}
+
+// publicPath returns the path clients reach a route path on, which is beneath
+// the configured mount path unless the route path is already under it.
+func publicPath(path string) string {
+	prefix := strings.TrimSuffix(configValue(configPathPrefix, ""), "/")
+	if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+		return path
+	}
+	return prefix + path
+}
+
+// handle registers h for requests matching method and pattern.
+func (rt *router) handle(method, pattern string, h http.HandlerFunc) {
+	for _, rte := range rt.routes {
+		if rte.pattern == pattern {
+			rte.methods[method] = h
+			return
+		}
+	}
+	rt.routes = append(rt.routes, &route{
+		pattern:  pattern,
+		segments: splitPath(pattern),
+		methods:  map[string]http.HandlerFunc{method: h},
+	})
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	for _, rte := range rt.routes {
+		values, ok := rte.match(segments)
+		if !ok {
+			continue
+		}
+
+		h, ok := rte.methods[r.Method]
+		if !ok {
+			logger.Error("Method not allowed", "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("Allow", rte.allow())
+			writeProblem(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "method "+r.Method+" not allowed")
+			return
+		}
+
+		for name, value := range values {
+			r.SetPathValue(name, value)
+		}
+		h(w, r)
+		return
+	}
+
+	logger.Error("Path not found", "path", r.URL.Path)
+	writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "path not found")
+}
+
+// match reports whether segments match the route, returning the wildcard
+// values when they do.
+func (rte *route) match(segments []string) (map[string]string, bool) {
+	values := map[string]string{}
+	for i, pat := range rte.segments {
+		if i >= len(segments) {
+			return nil, false
+		}
+		seg := segments[i]
+		if name, ok := strings.CutSuffix(pat, "...}"); ok && i == len(rte.segments)-1 {
+			values[name[1:]] = strings.Join(segments[i:], "/")
+			return values, true
+		}
+		if !strings.HasPrefix(pat, "{") {
+			if pat != seg {
+				return nil, false
+			}
+			continue
+		}
+
+		name, suffix, _ := strings.Cut(pat[1:], "}")
+		if suffix == "" && strings.Contains(seg, ":") {
+			return nil, false
+		}
+		value, ok := strings.CutSuffix(seg, suffix)
+		if !ok || value == "" {
+			return nil, false
+		}
+		values[name] = value
+	}
+	if len(segments) != len(rte.segments) {
+		return nil, false
+	}
+	return values, true
+}
+
+// allow returns the value of the Allow header for the route.
+func (rte *route) allow() string {
+	methods := make([]string, 0, len(rte.methods))
+	for method := range rte.methods {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+	return strings.Join(methods, ", ")
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/atomics"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/auth"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+// Deleting a composer only moves it to the trash by setting DeletedAt. It is
+// hidden from reads and listings, can be restored, and is removed for good by
+// a purge once it has been in the trash longer than the trash-retention
+// config. A composer which works still list is kept in the trash until they no
+// longer do, so purging never leaves a work naming a missing composer.
+//
+// The trash is purged by the purge endpoint, and on schedule by the keyvalue
+// watcher, which starts a purge on the first write it sees in each
+// purge-interval. A bucket which isn't written to isn't purged until it is.
+const purgePrefix = "purge:"
+
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Restoring composer")
+
+	// Get composer ID
+	id := r.PathValue("id")
+
+	// Check permission, as restoring undoes a delete
+	err := principal(r).Check(composersResource, auth.ActionDelete, nil)
+	if err != nil {
+		logger.Error("Principal may not restore composer", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	comp, ok, err := getComposer(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "composer does not exist")
+		return
+	} else if !comp.Deleted() {
+		logger.Error("Value is not deleted", "id", id)
+		writeProblem(w, r, http.StatusConflict, problem.CodeConflict, "composer is not deleted")
+		return
+	}
+
+	// Check precondition
+	if !ifMatch(r, etag(comp)) {
+		logger.Error("Revision does not match", "id", id, "etag", etag(comp))
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "revision does not match")
+		return
+	}
+
+	// Restore value
+	before := comp
+	comp.DeletedAt = nil
+	comp, err = putComposer(*bucket, actor(r), composer.ActionRestored, &before, comp)
+	if err != nil {
+		logger.Error("Error setting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	setValidators(w, comp)
+	writeJSON(w, http.StatusOK, comp)
+}
+
+func purgeHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Purging deleted composers")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Purge trash
+	purged, kept, err := purgeTrash(*bucket)
+	if err != nil {
+		logger.Error("Error purging composers", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	purgeResponse := map[string]any{
+		"purged":  purged,
+		"kept":    kept,
+		"message": "composers purged",
+	}
+	writeJSON(w, http.StatusOK, purgeResponse)
+}
+
+// purgeTrash deletes the composers which have been in the trash past the
+// retention, returning their ids along with those of the composers kept
+// because works still list them.
+func purgeTrash(bucket store.Bucket) ([]string, []string, error) {
+	purged, kept := []string{}, []string{}
+	cutoff := now().Add(-configDuration(configTrashRetention, defaultTrashRetention))
+	linkedToWorks := linkedFrom("composer-works")
+
+	ids, err := readIndex(bucket, trashIndexKey)
+	if err != nil {
+		return purged, kept, err
+	}
+	for _, id := range ids {
+		comp, ok, err := getComposer(bucket, id)
+		if err != nil {
+			return purged, kept, err
+		} else if !ok || !comp.Deleted() || comp.DeletedAt.After(cutoff) {
+			continue
+		}
+
+		linked, err := linkedToWorks(bucket, id)
+		if err != nil {
+			return purged, kept, err
+		} else if linked {
+			logger.Info("Keeping composer linked from works", "id", id)
+			kept = append(kept, id)
+			continue
+		}
+
+		res := bucket.Delete(id)
+		if res.IsErr() {
+			return purged, kept, newStoreError("error deleting value", res.Err())
+		}
+		err = deleteHistory(bucket, id, comp.Revision)
+		if err != nil {
+			logger.Error("Error deleting history", "id", id, "error", err)
+		}
+		purged = append(purged, id)
+	}
+	return purged, kept, nil
+}
+
+// schedulePurge purges the trash if no purge has been started yet in the
+// current purge interval. The interval is claimed by incrementing its counter,
+// so only the first caller in each interval purges, and the counter of the
+// interval before is deleted.
+func schedulePurge(bucket store.Bucket) {
+	interval := configDuration(configPurgeInterval, defaultPurgeInterval)
+	if interval <= 0 {
+		return
+	}
+	n := uint64(now().UnixNano() / int64(interval))
+
+	res := atomics.Increment(bucket, purgeKey(n), 1)
+	if res.IsErr() {
+		logger.Error("Error claiming purge", "error", res.Err())
+		return
+	} else if *res.OK() != 1 {
+		return
+	}
+	delRes := bucket.Delete(purgeKey(n - 1))
+	if delRes.IsErr() {
+		logger.Error("Error deleting purge counter", "error", delRes.Err())
+	}
+
+	logger.Info("Purging deleted composers on schedule")
+	purged, kept, err := purgeTrash(bucket)
+	if err != nil {
+		logger.Error("Error purging composers", "error", err)
+		return
+	}
+	logger.Info("Purged deleted composers", "purged", len(purged), "kept", len(kept))
+}
+
+// purgeKey returns the key of the counter claiming purge interval n.
+func purgeKey(n uint64) string {
+	return purgePrefix + strconv.FormatUint(n, 10)
+}
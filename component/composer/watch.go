@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/watcher"
+)
+
+// The keyvalue watcher is called after every write to the composer bucket,
+// whether made by a handler or by a tool which bypasses the handlers, such as
+// a bulk load straight into the store. Each write of a primary record syncs
+// the data derived from it, which nothing else does outside of a rebuild;
+// writes of derived data, including those made here, are ignored, so watching
+// doesn't feed back on itself. Writes of primary records also start the
+// scheduled purge of the trash.
+
+func init() {
+	watcher.Exports.OnSet = onSet
+	watcher.Exports.OnDelete = onDelete
+}
+
+func onSet(bucket store.Bucket, key string, value cm.List[uint8]) {
+	defer bucket.ResourceDrop()
+	if !isRecordKey(key) {
+		return
+	}
+	logger.Info("Handling set", "key", key)
+
+	err := syncDerived(bucket, recordChange{key: key, value: value.Slice()})
+	if err != nil {
+		logger.Error("Error updating derived data", "key", key, "error", err)
+	}
+	schedulePurge(bucket)
+}
+
+func onDelete(bucket store.Bucket, key string) {
+	defer bucket.ResourceDrop()
+	if !isRecordKey(key) {
+		return
+	}
+	logger.Info("Handling delete", "key", key)
+
+	err := syncDerived(bucket, recordChange{key: key})
+	if err != nil {
+		logger.Error("Error updating derived data", "key", key, "error", err)
+	}
+	schedulePurge(bucket)
+}
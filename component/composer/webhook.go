@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+	"github.com/jamesstocktonj1/mulib/pkg/webhook"
+)
+
+// Webhook subscriptions are stored together in the composer bucket under
+// "webhooks", ordered by id, so that publishing an event reads a single key to
+// find the subscriptions it matches. Each change to a subscription rewrites
+// that key, so two changes at once can race; subscriptions are administered
+// rarely, unlike the records whose events they receive. The signing secret of
+// a subscription is only returned by the request which created it.
+const (
+	webhooksKey = "webhooks"
+
+	// secretBytes is the length of a generated signing secret, before hex
+	// encoding.
+	secretBytes = 32
+)
+
+type webhooksResponse struct {
+	Webhooks []webhook.Subscription `json:"webhooks"`
+}
+
+func listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing webhooks")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Read subscriptions
+	subs, err := listWebhooks(*bucket)
+	if err != nil {
+		logger.Error("Error listing webhooks", "error", err)
+		writeError(w, r, err)
+		return
+	}
+	for i := range subs {
+		subs[i] = subs[i].Redacted()
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, webhooksResponse{Webhooks: subs})
+}
+
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Creating new webhook")
+
+	// Unmarshal request
+	sub := webhook.Subscription{}
+	err := json.NewDecoder(r.Body).Decode(&sub)
+	if err != nil {
+		logger.Error("Error decoding request", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Set ID and secret
+	sub = webhook.Subscription{ID: uuid.New().String()}.Replace(sub)
+	if sub.Secret == "" {
+		sub.Secret, err = newSecret()
+		if err != nil {
+			logger.Error("Error generating secret", "error", err)
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	// Validate value
+	err = sub.Validate()
+	if err != nil {
+		logger.Error("Invalid webhook", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Set value
+	sub, err = putWebhook(*bucket, sub)
+	if err != nil {
+		logger.Error("Error setting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response, including the secret this once
+	w.Header().Set("Location", publicPath("/webhooks/"+sub.ID))
+	setRevisionValidators(w, sub.Revision, sub.UpdatedAt)
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+func readWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Reading webhook")
+
+	// Get webhook ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	sub, ok, err := getWebhook(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "webhook does not exist")
+		return
+	}
+
+	// Write response
+	setRevisionValidators(w, sub.Revision, sub.UpdatedAt)
+	writeJSON(w, http.StatusOK, sub.Redacted())
+}
+
+func updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Updating webhook")
+
+	// Get webhook ID
+	id := r.PathValue("id")
+
+	// Unmarshal request
+	subPut := webhook.Subscription{}
+	err := json.NewDecoder(r.Body).Decode(&subPut)
+	if err != nil {
+		logger.Error("Error decoding request", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeDecodeFailed, err.Error())
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	sub, ok, err := getWebhook(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "webhook does not exist")
+		return
+	}
+
+	// Check precondition
+	if !ifMatch(r, revisionTag(sub.Revision)) {
+		logger.Error("Revision does not match", "id", id, "etag", revisionTag(sub.Revision))
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "revision does not match")
+		return
+	}
+
+	// Replace value
+	sub = sub.Replace(subPut)
+
+	// Validate value
+	err = sub.Validate()
+	if err != nil {
+		logger.Error("Invalid webhook", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Set value
+	sub, err = putWebhook(*bucket, sub)
+	if err != nil {
+		logger.Error("Error setting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	setRevisionValidators(w, sub.Revision, sub.UpdatedAt)
+	writeJSON(w, http.StatusOK, sub.Redacted())
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Deleting webhook")
+
+	// Get webhook ID
+	id := r.PathValue("id")
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get value
+	sub, ok, err := getWebhook(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "webhook does not exist")
+		return
+	}
+
+	// Check precondition
+	if !ifMatch(r, revisionTag(sub.Revision)) {
+		logger.Error("Revision does not match", "id", id, "etag", revisionTag(sub.Revision))
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "revision does not match")
+		return
+	}
+
+	// Delete value
+	err = deleteWebhook(*bucket, id)
+	if err != nil {
+		logger.Error("Error deleting value", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Delete deliveries
+	err = deleteDeliveries(*bucket, id)
+	if err != nil {
+		logger.Error("Error deleting deliveries", "id", id, "error", err)
+	}
+
+	// Write response
+	idResponse := map[string]string{
+		"id":      id,
+		"message": "webhook deleted",
+	}
+	writeJSON(w, http.StatusOK, idResponse)
+}
+
+// listWebhooks returns every subscription, ordered by id.
+func listWebhooks(bucket store.Bucket) ([]webhook.Subscription, error) {
+	subs := []webhook.Subscription{}
+
+	res := bucket.Get(webhooksKey)
+	if res.IsErr() {
+		return subs, newStoreError("error getting value", res.Err())
+	}
+	value := res.OK().Some()
+	if value == nil {
+		return subs, nil
+	}
+
+	err := json.Unmarshal(value.Slice(), &subs)
+	return subs, err
+}
+
+// setWebhooks replaces every subscription.
+func setWebhooks(bucket store.Bucket, subs []webhook.Subscription) error {
+	subsBytes, err := json.Marshal(subs)
+	if err != nil {
+		return err
+	}
+	res := bucket.Set(webhooksKey, cm.ToList(subsBytes))
+	if res.IsErr() {
+		return newStoreError("error setting value", res.Err())
+	}
+	return nil
+}
+
+func getWebhook(bucket store.Bucket, id string) (webhook.Subscription, bool, error) {
+	subs, err := listWebhooks(bucket)
+	if err != nil {
+		return webhook.Subscription{}, false, err
+	}
+
+	i, ok := slices.BinarySearchFunc(subs, id, compareWebhookID)
+	if !ok {
+		return webhook.Subscription{}, false, nil
+	}
+	return subs[i], true, nil
+}
+
+// putWebhook writes the next revision of sub. It returns the subscription as
+// stored.
+func putWebhook(bucket store.Bucket, sub webhook.Subscription) (webhook.Subscription, error) {
+	sub.Revision++
+	sub.UpdatedAt = now()
+
+	// Get subscriptions
+	subs, err := listWebhooks(bucket)
+	if err != nil {
+		return sub, err
+	}
+
+	// Set value
+	i, ok := slices.BinarySearchFunc(subs, sub.ID, compareWebhookID)
+	if ok {
+		subs[i] = sub
+	} else {
+		subs = slices.Insert(subs, i, sub)
+	}
+	return sub, setWebhooks(bucket, subs)
+}
+
+// deleteWebhook removes the subscription with the id, if there is one.
+func deleteWebhook(bucket store.Bucket, id string) error {
+	subs, err := listWebhooks(bucket)
+	if err != nil {
+		return err
+	}
+
+	i, ok := slices.BinarySearchFunc(subs, id, compareWebhookID)
+	if !ok {
+		return nil
+	}
+	return setWebhooks(bucket, slices.Delete(subs, i, i+1))
+}
+
+func compareWebhookID(sub webhook.Subscription, id string) int {
+	return strings.Compare(sub.ID, id)
+}
+
+// newSecret returns a random signing secret.
+func newSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/bytecodealliance/wasm-tools-go/cm"
+	"github.com/jamesstocktonj1/mulib/component/composer/gen/wasi/keyvalue/store"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+	"github.com/jamesstocktonj1/mulib/pkg/work"
+)
+
+// Works are stored in the composer bucket under "work:<id>" and linked to
+// their composers by the "idx:composer-works:<composer id>" index, which lists
+// the ids of every work the composer wrote. The "idx:catalogue:<number>" index
+// finds works by their catalogue numbers. Works are deleted outright rather
+// than moved to the trash.
+var works = &resource[work.Work, *work.Work]{
+	name:       "work",
+	plural:     "works",
+	prefix:     "work:",
+	indexKeys:  workIndexKeys,
+	checkLinks: checkWorkLinks,
+	inUse:      linkedFrom("work-recordings"),
+}
+
+// workIndexKeys returns the index keys a work should be listed under.
+func workIndexKeys(wk work.Work) []string {
+	keys := []string{}
+	for _, id := range wk.ComposerIDs {
+		keys = append(keys, indexKey("composer-works", id))
+	}
+	for _, num := range wk.CatalogueNumbers {
+		keys = append(keys, catalogueIndexKey(num))
+	}
+	return keys
+}
+
+type worksResponse struct {
+	Works []work.Work `json:"works"`
+	Next  string      `json:"next,omitempty"`
+}
+
+func composerWorksHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Listing composer works")
+
+	// Get composer ID
+	id := r.PathValue("id")
+
+	// Get page size
+	limit := defaultPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxPageSize {
+			logger.Error("Invalid limit query", "limit", l)
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid limit query")
+			return
+		}
+		limit = n
+	}
+
+	// Get cursor
+	cur, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		logger.Error("Invalid cursor query", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeBadRequest, "invalid cursor query")
+		return
+	}
+
+	// Open bucket
+	bucketRes := store.Open(componentName)
+	if bucketRes.IsErr() {
+		logger.Error("Error opening bucket", "error", bucketRes.Err())
+		writeError(w, r, newStoreError("error opening bucket", bucketRes.Err()))
+		return
+	}
+	bucket := bucketRes.OK()
+
+	// Get composer
+	comp, ok, err := getComposer(*bucket, id)
+	if err != nil {
+		logger.Error("Error getting value", "error", err)
+		writeError(w, r, err)
+		return
+	} else if !ok || comp.Deleted() {
+		logger.Error("Value does not exist", "id", id)
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "composer does not exist")
+		return
+	}
+
+	// Read index
+	ids, err := readIndex(*bucket, indexKey("composer-works", id))
+	if err != nil {
+		logger.Error("Error reading index", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Read page in catalogue order
+	page, err := sortedWorksPage(*bucket, ids, cur, limit)
+	if err != nil {
+		logger.Error("Error listing works", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// Write response
+	writeJSON(w, http.StatusOK, page)
+}
+
+// sortedWorksPage reads every work with the given ids and returns the page at
+// the offset of cur once they are ordered by catalogue number.
+func sortedWorksPage(bucket store.Bucket, ids []string, cur listCursor, limit int) (worksResponse, error) {
+	page := worksResponse{Works: []work.Work{}}
+
+	all, err := worksPage(bucket, ids, listCursor{Store: cm.None[uint64]()}, len(ids))
+	if err != nil {
+		return page, err
+	}
+	slices.SortStableFunc(all.Works, work.CompareCatalogue)
+
+	if cur.Offset < len(all.Works) {
+		end := min(cur.Offset+limit, len(all.Works))
+		page.Works = all.Works[cur.Offset:end]
+		if end < len(all.Works) {
+			page.Next = listCursor{Store: cm.None[uint64](), Offset: end}.encode()
+		}
+	}
+	return page, nil
+}
+
+// worksPage reads the works with the given ids, starting at the offset of cur.
+func worksPage(bucket store.Bucket, ids []string, cur listCursor, limit int) (worksResponse, error) {
+	page := worksResponse{Works: []work.Work{}}
+
+	for ; cur.Offset < len(ids) && len(page.Works) < limit; cur.Offset++ {
+		wk, ok, err := works.get(bucket, ids[cur.Offset])
+		if err != nil {
+			return page, err
+		} else if !ok {
+			continue
+		}
+		page.Works = append(page.Works, wk)
+	}
+
+	if cur.Offset < len(ids) {
+		page.Next = cur.encode()
+	}
+	return page, nil
+}
+
+// checkWorkLinks checks that every composer linked from the work exists and
+// is not in the trash.
+func checkWorkLinks(bucket store.Bucket, wk work.Work) error {
+	verr := &work.ValidationError{}
+	for i, id := range wk.ComposerIDs {
+		comp, ok, err := getComposer(bucket, id)
+		if err != nil {
+			return err
+		} else if !ok || comp.Deleted() {
+			verr.Fields = append(verr.Fields, composer.FieldError{
+				Field:   fmt.Sprintf("composerIds[%d]", i),
+				Message: "composer does not exist",
+			})
+		}
+	}
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
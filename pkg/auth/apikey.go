@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	MethodAPIKey = "api-key"
+)
+
+var (
+	ErrInvalidKeyring = errors.New("invalid keyring")
+)
+
+// APIKey is a key a caller may present. Only the SHA-256 hash of the key is
+// kept, so the keyring reveals nothing that could be presented. A key is
+// granted the rules of its scopes, and of its roles under the policy.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"`
+	Scopes []Scope  `json:"scopes"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+// Keyring is the set of valid API keys.
+type Keyring []APIKey
+
+// HashKey returns the hex SHA-256 hash of key, as stored in a keyring.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseKeyring decodes a keyring from its JSON form, e.g.
+//
+//	[{"id": "importer", "hash": "9f86d0...", "scopes": ["write"]}]
+func ParseKeyring(b []byte) (Keyring, error) {
+	kr := Keyring{}
+	err := json.Unmarshal(b, &kr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyring, err)
+	}
+
+	for i, key := range kr {
+		hash, err := hex.DecodeString(key.Hash)
+		if key.ID == "" {
+			return nil, fmt.Errorf("%w: key %d has no id", ErrInvalidKeyring, i)
+		} else if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%w: key %s hash must be a hex SHA-256 hash", ErrInvalidKeyring, key.ID)
+		}
+		kr[i].Hash = strings.ToLower(key.Hash)
+		for _, scope := range key.Scopes {
+			if !scope.Valid() {
+				return nil, fmt.Errorf("%w: key %s has unknown scope %q", ErrInvalidKeyring, key.ID, scope)
+			}
+		}
+	}
+	return kr, nil
+}
+
+// Authenticate returns the principal of the key matching presented. Every key
+// is compared in constant time, so the time taken doesn't reveal which key
+// came closest.
+func (kr Keyring) Authenticate(presented string) (Principal, bool) {
+	hash := HashKey(presented)
+
+	var match *APIKey
+	for i := range kr {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(kr[i].Hash)) == 1 {
+			match = &kr[i]
+		}
+	}
+	if match == nil {
+		return Principal{}, false
+	}
+	p := Principal{Subject: match.ID, Method: MethodAPIKey, Roles: match.Roles}
+	for _, scope := range match.Scopes {
+		p.Rules = append(p.Rules, scope.Rules()...)
+	}
+	return p, true
+}
@@ -0,0 +1,86 @@
+// Package auth authenticates callers and decides what they may do. A caller
+// is identified as a Principal holding the rules it was granted, by its scopes
+// or by the roles a Policy assigns rules to.
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Scope is a coarse grant of access given to an API key, which stands for a
+// set of permissions. Each scope includes the ones below it: write includes
+// read, and admin includes write.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes lists the valid scopes.
+var Scopes = []Scope{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Valid reports whether s is a known scope.
+func (s Scope) Valid() bool {
+	return slices.Contains(Scopes, s)
+}
+
+// MethodJWT names principals authenticated by a bearer token.
+const MethodJWT = "jwt"
+
+// MethodAnonymous names principals which presented no credentials.
+const MethodAnonymous = "anonymous"
+
+// Principal is an authenticated caller. Method names how it was
+// authenticated, such as "api-key" or "jwt". Roles are the roles it claims,
+// which a Policy turns into rules.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Roles   []string `json:"roles"`
+	Rules   []Rule   `json:"rules"`
+}
+
+// Can reports whether any of the principal's rules grants action on resource.
+func (p Principal) Can(resource string, action Action) bool {
+	return len(p.granting(resource, action)) > 0
+}
+
+// Check returns a *DeniedError unless the principal's rules grant action on
+// resource and, between them, allow every one of fields to be changed.
+func (p Principal) Check(resource string, action Action, fields []string) error {
+	rules := p.granting(resource, action)
+	if len(rules) == 0 {
+		return &DeniedError{Permission: NewPermission(resource, action)}
+	}
+	if denied := deniedFields(rules, fields); len(denied) > 0 {
+		return &DeniedError{Permission: NewPermission(resource, action), Fields: denied}
+	}
+	return nil
+}
+
+// granting returns the principal's rules which grant action on resource.
+func (p Principal) granting(resource string, action Action) []Rule {
+	rules := []Rule{}
+	for _, rule := range p.Rules {
+		if rule.Permission.Grants(resource, action) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal carried by ctx, if any.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Action is something a caller does to a resource.
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+
+	// ActionAdmin covers maintenance of a resource, such as purging the
+	// trash or rebuilding indexes.
+	ActionAdmin Action = "admin"
+)
+
+// Actions lists every action.
+var Actions = []Action{ActionRead, ActionCreate, ActionUpdate, ActionDelete, ActionAdmin}
+
+// wildcard matches any resource or action in a permission.
+const wildcard = "*"
+
+// Permission grants an action on a resource, written "<resource>:<action>",
+// e.g. "composers:update". Either part may be "*" to match anything.
+type Permission string
+
+// NewPermission returns the permission for action on resource.
+func NewPermission(resource string, action Action) Permission {
+	return Permission(resource + ":" + string(action))
+}
+
+// ParsePermission checks that s is a permission.
+func ParsePermission(s string) (Permission, error) {
+	resource, action, ok := strings.Cut(s, ":")
+	if !ok || resource == "" {
+		return "", fmt.Errorf("invalid permission %q: must be <resource>:<action>", s)
+	}
+	if action != wildcard && !slices.Contains(Actions, Action(action)) {
+		return "", fmt.Errorf("invalid permission %q: unknown action", s)
+	}
+	return Permission(s), nil
+}
+
+// Grants reports whether p grants action on resource.
+func (p Permission) Grants(resource string, action Action) bool {
+	pr, pa, _ := strings.Cut(string(p), ":")
+	return (pr == wildcard || pr == resource) && (pa == wildcard || pa == string(action))
+}
+
+// Rules returns the rules granted by a scope, none of which are limited to
+// some fields.
+func (s Scope) Rules() []Rule {
+	switch s {
+	case ScopeRead:
+		return []Rule{{Permission: "*:read"}}
+	case ScopeWrite:
+		return []Rule{{Permission: "*:read"}, {Permission: "*:create"}, {Permission: "*:update"}, {Permission: "*:delete"}}
+	case ScopeAdmin:
+		return []Rule{{Permission: "*:*"}}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Rule grants a permission, optionally only over some fields of a record.
+type Rule struct {
+	Permission Permission `json:"permission"`
+
+	// Fields, when set, are the only fields a caller may set on create or
+	// change on update under the rule, by their JSON names. A rule without
+	// fields allows any field.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// UnmarshalJSON accepts a rule written as a bare permission as well as an
+// object.
+func (r *Rule) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*r = Rule{Permission: Permission(s)}
+		return nil
+	}
+	type plain Rule
+	return json.Unmarshal(b, (*plain)(r))
+}
+
+// Policy is a role based access control policy. Each role is granted a set of
+// rules, e.g.
+//
+//	{"roles": {
+//		"editor": ["*:read", {"permission": "composers:update", "fields": ["firstname", "lastname"]}],
+//		"curator": ["*:*"]
+//	}}
+type Policy struct {
+	Roles map[string][]Rule `json:"roles"`
+}
+
+// ParsePolicy decodes a policy from its JSON form, checking every permission.
+func ParsePolicy(b []byte) (Policy, error) {
+	policy := Policy{}
+	err := json.Unmarshal(b, &policy)
+	if err != nil {
+		return policy, fmt.Errorf("invalid policy: %s", err)
+	}
+
+	for role, rules := range policy.Roles {
+		for _, rule := range rules {
+			_, err := ParsePermission(string(rule.Permission))
+			if err != nil {
+				return policy, fmt.Errorf("invalid policy for role %q: %s", role, err)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Rules returns the rules the policy grants roles. A role the policy doesn't
+// define grants nothing, whatever its name.
+func (p Policy) Rules(roles []string) []Rule {
+	rules := []Rule{}
+	for _, role := range roles {
+		if granted, ok := p.Roles[role]; ok {
+			rules = append(rules, granted...)
+		}
+	}
+	return rules
+}
+
+// DeniedError reports an action a principal may not take. When the principal
+// may take the action but not change every field it touches, Fields lists
+// those it may not change.
+type DeniedError struct {
+	Permission Permission
+	Fields     []string
+}
+
+func (e *DeniedError) Error() string {
+	if len(e.Fields) == 0 {
+		return "the " + string(e.Permission) + " permission is required"
+	}
+	return "the " + string(e.Permission) + " permission does not cover " + strings.Join(e.Fields, ", ")
+}
+
+// deniedFields returns the fields which none of rules allow to be changed.
+// Rules without fields allow every field.
+func deniedFields(rules []Rule, fields []string) []string {
+	allowed := []string{}
+	for _, rule := range rules {
+		if len(rule.Fields) == 0 {
+			return nil
+		}
+		allowed = append(allowed, rule.Fields...)
+	}
+
+	denied := []string{}
+	for _, field := range fields {
+		if !slices.Contains(allowed, field) {
+			denied = append(denied, field)
+		}
+	}
+	return denied
+}
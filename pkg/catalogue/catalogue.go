@@ -0,0 +1,266 @@
+// Package catalogue parses, formats and orders the thematic catalogue numbers
+// used to identify classical works, such as "BWV 1046a", "K. 525",
+// "Hob. XVI:52", "D. 944" and "Op. 27 No. 2".
+package catalogue
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidScheme = errors.New("invalid catalogue scheme")
+	ErrInvalidNumber = errors.New("invalid catalogue number")
+)
+
+// Scheme is a catalogue a work may be numbered in.
+type Scheme string
+
+const (
+	SchemeBWV     Scheme = "BWV" // Bach-Werke-Verzeichnis
+	SchemeKoechel Scheme = "K"   // Köchel, for Mozart
+	SchemeHoboken Scheme = "Hob" // Hoboken, for Haydn
+	SchemeDeutsch Scheme = "D"   // Deutsch, for Schubert
+	SchemeOpus    Scheme = "Op"
+	SchemeWoO     Scheme = "WoO" // Werke ohne Opuszahl, works without opus number
+)
+
+// Schemes lists the supported schemes in the order numbers are sorted by.
+var Schemes = []Scheme{SchemeBWV, SchemeKoechel, SchemeHoboken, SchemeDeutsch, SchemeOpus, SchemeWoO}
+
+var (
+	schemePattern  = regexp.MustCompile(`(?i)^(bwv|kv|k|hob|d|opus|op|woo)\.?\s*(.*)$`)
+	editionPattern = regexp.MustCompile(`^(\d)\s+(.+)$`)
+	hobokenPattern = regexp.MustCompile(`(?i)^([IVXL]+)([a-z]?)\s*:\s*(\d+)([a-z]*)$`)
+	opusPattern    = regexp.MustCompile(`(?i)^(\d+)([a-z]*)(?:\s*(?:,\s*)?(?:no\.?|/)\s*(\d+))?$`)
+	numberPattern  = regexp.MustCompile(`(?i)^(\d+)([a-z]*)$`)
+)
+
+// ParseScheme parses the name or abbreviation of a scheme, e.g. "KV" or "hob.".
+func ParseScheme(s string) (Scheme, error) {
+	m := schemePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || m[2] != "" {
+		return "", ErrInvalidScheme
+	}
+	return schemeOf(m[1]), nil
+}
+
+// UnmarshalText decodes a scheme from any of its abbreviations. Text which
+// isn't a known scheme is kept as it is, so that it can be reported when the
+// value is validated.
+func (s *Scheme) UnmarshalText(text []byte) error {
+	scheme, err := ParseScheme(string(text))
+	if err != nil {
+		*s = Scheme(text)
+		return nil
+	}
+	*s = scheme
+	return nil
+}
+
+func schemeOf(abbr string) Scheme {
+	switch strings.ToLower(abbr) {
+	case "bwv":
+		return SchemeBWV
+	case "k", "kv":
+		return SchemeKoechel
+	case "hob":
+		return SchemeHoboken
+	case "d":
+		return SchemeDeutsch
+	case "op", "opus":
+		return SchemeOpus
+	default:
+		return SchemeWoO
+	}
+}
+
+// Number is a catalogue number.
+type Number struct {
+	Scheme Scheme
+
+	// Edition is the edition of the catalogue the number is from, such as 6
+	// for "K6 525". It is zero when the edition isn't given.
+	Edition int
+
+	// Group is the roman numeral group of a Hoboken number, such as "XVI" in
+	// "Hob. XVI:52", with its optional letter.
+	Group string
+
+	Number int
+
+	// Suffix is the letter distinguishing related works, such as "a" in
+	// "BWV 1046a".
+	Suffix string
+
+	// Sub is the number of the work within an opus, such as 2 in
+	// "Op. 27 No. 2". It is zero when the opus is a single work.
+	Sub int
+}
+
+// Parse parses a catalogue number written with any of the usual abbreviations
+// of its scheme. It returns the zero Number with the error when s isn't one.
+func Parse(s string) (Number, error) {
+	m := schemePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Number{}, ErrInvalidNumber
+	}
+	n := Number{Scheme: schemeOf(m[1])}
+	rest := m[2]
+
+	var err error
+
+	if n.Scheme == SchemeKoechel {
+		if e := editionPattern.FindStringSubmatch(rest); e != nil {
+			n.Edition, err = atoi(e[1])
+			if err != nil {
+				return Number{}, err
+			}
+			rest = e[2]
+		}
+	}
+
+	switch n.Scheme {
+	case SchemeHoboken:
+		h := hobokenPattern.FindStringSubmatch(rest)
+		if h == nil {
+			return Number{}, ErrInvalidNumber
+		}
+		n.Group = strings.ToUpper(h[1]) + strings.ToLower(h[2])
+		n.Number, err = atoi(h[3])
+		n.Suffix = strings.ToLower(h[4])
+	case SchemeOpus:
+		o := opusPattern.FindStringSubmatch(rest)
+		if o == nil {
+			return Number{}, ErrInvalidNumber
+		}
+		n.Number, err = atoi(o[1])
+		n.Suffix = strings.ToLower(o[2])
+		if err == nil && o[3] != "" {
+			n.Sub, err = atoi(o[3])
+		}
+	default:
+		d := numberPattern.FindStringSubmatch(rest)
+		if d == nil {
+			return Number{}, ErrInvalidNumber
+		}
+		n.Number, err = atoi(d[1])
+		n.Suffix = strings.ToLower(d[2])
+	}
+	if err != nil {
+		return Number{}, err
+	}
+	return n, nil
+}
+
+// atoi parses digits matched by a pattern, which only fails when they don't
+// fit in an int.
+func atoi(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidNumber, err)
+	}
+	return n, nil
+}
+
+// String returns the canonical form of the number, or "" for the zero Number.
+func (n Number) String() string {
+	if n == (Number{}) {
+		return ""
+	}
+	num := strconv.Itoa(n.Number) + n.Suffix
+	switch n.Scheme {
+	case SchemeKoechel:
+		if n.Edition != 0 {
+			return "K" + strconv.Itoa(n.Edition) + " " + num
+		}
+		return "K. " + num
+	case SchemeHoboken:
+		return "Hob. " + n.Group + ":" + num
+	case SchemeDeutsch:
+		return "D. " + num
+	case SchemeOpus:
+		if n.Sub != 0 {
+			return "Op. " + num + " No. " + strconv.Itoa(n.Sub)
+		}
+		return "Op. " + num
+	default:
+		return string(n.Scheme) + " " + num
+	}
+}
+
+func (n Number) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+func (n *Number) UnmarshalText(text []byte) error {
+	num, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*n = num
+	return nil
+}
+
+// Compare orders numbers by scheme, then edition and then numerically within
+// the catalogue, so that "BWV 1046" sorts before "BWV 1046a" and "BWV 1047".
+// It returns -1, 0 or +1.
+func Compare(a, b Number) int {
+	if c := cmp.Compare(slices.Index(Schemes, a.Scheme), slices.Index(Schemes, b.Scheme)); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Edition, b.Edition); c != 0 {
+		return c
+	}
+	if c := compareGroup(a.Group, b.Group); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Number, b.Number); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Suffix, b.Suffix); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Sub, b.Sub)
+}
+
+// compareGroup orders Hoboken groups by the value of their roman numeral and
+// then their letter.
+func compareGroup(a, b string) int {
+	aNum, aSuffix := splitGroup(a)
+	bNum, bSuffix := splitGroup(b)
+	if c := cmp.Compare(aNum, bNum); c != 0 {
+		return c
+	}
+	return strings.Compare(aSuffix, bSuffix)
+}
+
+func splitGroup(group string) (int, string) {
+	i := strings.IndexFunc(group, func(r rune) bool {
+		return !strings.ContainsRune("IVXL", r)
+	})
+	if i < 0 {
+		i = len(group)
+	}
+	return roman(group[:i]), group[i:]
+}
+
+// roman returns the value of a roman numeral.
+func roman(s string) int {
+	values := map[byte]int{'I': 1, 'V': 5, 'X': 10, 'L': 50}
+	total := 0
+	for i := 0; i < len(s); i++ {
+		v := values[s[i]]
+		if i+1 < len(s) && values[s[i+1]] > v {
+			total -= v
+		} else {
+			total += v
+		}
+	}
+	return total
+}
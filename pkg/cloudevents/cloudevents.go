@@ -0,0 +1,148 @@
+// Package cloudevents encodes and decodes events in the CloudEvents 1.0
+// envelope, in structured mode as a JSON document and in binary mode as
+// headers alongside the data.
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SpecVersion = "1.0"
+
+	// ContentType is the media type of an event in structured mode.
+	ContentType = "application/cloudevents+json"
+
+	// HeaderPrefix prefixes the attribute names of an event in binary mode.
+	HeaderPrefix = "ce-"
+
+	dataContentType = "application/json"
+)
+
+var ErrInvalidEvent = errors.New("invalid cloudevent")
+
+// Event is a CloudEvent with JSON data.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// New returns an event with a new id holding data encoded as JSON.
+func New(source, eventType, subject string, t time.Time, dataSchema string, data any) (Event, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.New().String(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            t.UTC().Format(time.RFC3339Nano),
+		DataContentType: dataContentType,
+		DataSchema:      dataSchema,
+		Data:            dataBytes,
+	}, nil
+}
+
+// Validate checks that the required attributes are set.
+func (e Event) Validate() error {
+	switch {
+	case e.SpecVersion != SpecVersion:
+		return errors.Join(ErrInvalidEvent, errors.New("specversion must be "+SpecVersion))
+	case e.ID == "":
+		return errors.Join(ErrInvalidEvent, errors.New("id is required"))
+	case e.Source == "":
+		return errors.Join(ErrInvalidEvent, errors.New("source is required"))
+	case e.Type == "":
+		return errors.Join(ErrInvalidEvent, errors.New("type is required"))
+	}
+	return nil
+}
+
+// Structured returns the event in structured mode.
+func (e Event) Structured() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Binary returns the event in binary mode: its attributes as headers, and its
+// data as the body. The data content type is the Content-Type header.
+func (e Event) Binary() (map[string]string, []byte) {
+	headers := map[string]string{
+		HeaderPrefix + "specversion": e.SpecVersion,
+		HeaderPrefix + "id":          e.ID,
+		HeaderPrefix + "source":      e.Source,
+		HeaderPrefix + "type":        e.Type,
+	}
+	optional := map[string]string{
+		"subject":    e.Subject,
+		"time":       e.Time,
+		"dataschema": e.DataSchema,
+	}
+	for name, value := range optional {
+		if value != "" {
+			headers[HeaderPrefix+name] = value
+		}
+	}
+	if e.DataContentType != "" {
+		headers["Content-Type"] = e.DataContentType
+	}
+	return headers, e.Data
+}
+
+// ParseStructured decodes and validates an event in structured mode.
+func ParseStructured(b []byte) (Event, error) {
+	e := Event{}
+	err := json.Unmarshal(b, &e)
+	if err != nil {
+		return e, errors.Join(ErrInvalidEvent, err)
+	}
+	return e, e.Validate()
+}
+
+// ParseBinary decodes and validates an event in binary mode. Header names are
+// matched case-insensitively.
+func ParseBinary(headers map[string]string, body []byte) (Event, error) {
+	e := Event{Data: body}
+	for name, value := range headers {
+		name = strings.ToLower(name)
+		if name == "content-type" {
+			e.DataContentType = value
+			continue
+		}
+		attr, ok := strings.CutPrefix(name, HeaderPrefix)
+		if !ok {
+			continue
+		}
+		switch attr {
+		case "specversion":
+			e.SpecVersion = value
+		case "id":
+			e.ID = value
+		case "source":
+			e.Source = value
+		case "type":
+			e.Type = value
+		case "subject":
+			e.Subject = value
+		case "time":
+			e.Time = value
+		case "dataschema":
+			e.DataSchema = value
+		}
+	}
+	return e, e.Validate()
+}
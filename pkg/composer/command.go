@@ -0,0 +1,60 @@
+package composer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jamesstocktonj1/mulib/pkg/problem"
+)
+
+var (
+	ErrInvalidCommand = errors.New("invalid command")
+)
+
+// Command names, mirroring the POST, PUT and DELETE composer endpoints.
+const (
+	CommandCreate = "create"
+	CommandUpdate = "update"
+	CommandDelete = "delete"
+)
+
+// Command is a request to change a composer received as a message. Revision,
+// when set, must match the current revision of the composer, as If-Match does
+// for the HTTP endpoints.
+type Command struct {
+	Command  string    `json:"command"`
+	ID       string    `json:"id,omitempty"`
+	Revision uint64    `json:"revision,omitempty"`
+	Composer *Composer `json:"composer,omitempty"`
+}
+
+// Validate checks that the command names a known command with the fields it
+// needs.
+func (c Command) Validate() error {
+	switch c.Command {
+	case CommandCreate:
+		if c.Composer == nil {
+			return fmt.Errorf("%w: create requires a composer", ErrInvalidCommand)
+		}
+	case CommandUpdate:
+		if c.ID == "" || c.Composer == nil {
+			return fmt.Errorf("%w: update requires an id and a composer", ErrInvalidCommand)
+		}
+	case CommandDelete:
+		if c.ID == "" {
+			return fmt.Errorf("%w: delete requires an id", ErrInvalidCommand)
+		}
+	default:
+		return fmt.Errorf("%w: command must be create, update or delete", ErrInvalidCommand)
+	}
+	return nil
+}
+
+// CommandReply is the reply to a command. It holds the composer as stored
+// when the command succeeded, and the problem otherwise.
+type CommandReply struct {
+	Command  string           `json:"command"`
+	ID       string           `json:"id,omitempty"`
+	Composer *Composer        `json:"composer,omitempty"`
+	Error    *problem.Problem `json:"error,omitempty"`
+}
@@ -0,0 +1,90 @@
+package composer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jamesstocktonj1/mulib/pkg/catalogue"
+)
+
+var ErrUnknownColumn = errors.New("unknown csv column")
+
+// CSVColumns are the columns of a composer written as CSV. Catalogues are
+// separated by semicolons within their column.
+var CSVColumns = []string{
+	"id",
+	"firstname",
+	"lastname",
+	"birthDate",
+	"deathDate",
+	"era",
+	"nationality",
+	"catalogues",
+}
+
+// CheckCSVHeader returns ErrUnknownColumn if header names a column which isn't
+// one of CSVColumns. Columns may be in any order and any may be left out.
+func CheckCSVHeader(header []string) error {
+	for _, column := range header {
+		if !slices.Contains(CSVColumns, strings.TrimSpace(column)) {
+			return fmt.Errorf("%w: %s", ErrUnknownColumn, column)
+		}
+	}
+	return nil
+}
+
+// FromCSV returns the composer in record, whose columns are named by header.
+func FromCSV(header, record []string) Composer {
+	c := Composer{}
+	for i, column := range header {
+		if i >= len(record) {
+			break
+		}
+		value := strings.TrimSpace(record[i])
+		switch strings.TrimSpace(column) {
+		case "id":
+			c.ID = value
+		case "firstname":
+			c.Firstname = value
+		case "lastname":
+			c.Lastname = value
+		case "birthDate":
+			c.BirthDate = MustParseHistoricalDate(value)
+		case "deathDate":
+			c.DeathDate = MustParseHistoricalDate(value)
+		case "era":
+			c.Era = value
+		case "nationality":
+			c.Nationality = value
+		case "catalogues":
+			for _, scheme := range strings.Split(value, ";") {
+				if scheme = strings.TrimSpace(scheme); scheme != "" {
+					var s catalogue.Scheme
+					_ = s.UnmarshalText([]byte(scheme))
+					c.Catalogues = append(c.Catalogues, s)
+				}
+			}
+		}
+	}
+	return c
+}
+
+// CSVRecord returns the composer as a CSV record in the order of CSVColumns.
+func (c Composer) CSVRecord() []string {
+	schemes := make([]string, len(c.Catalogues))
+	for i, s := range c.Catalogues {
+		schemes[i] = string(s)
+	}
+	return []string{
+		c.ID,
+		c.Firstname,
+		c.Lastname,
+		c.BirthDate.String(),
+		c.DeathDate.String(),
+		c.Era,
+		c.Nationality,
+		strings.Join(schemes, ";"),
+	}
+}
@@ -0,0 +1,241 @@
+package composer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidDate = errors.New("invalid date")
+
+// Precision is the granularity to which a historical date is known.
+type Precision string
+
+const (
+	PrecisionDay   Precision = "day"
+	PrecisionMonth Precision = "month"
+	PrecisionYear  Precision = "year"
+)
+
+const sortableLayout = "2006-01-02"
+
+var (
+	// qualifiedDate splits a date into its floruit and circa qualifiers, the
+	// date itself and a trailing question mark.
+	qualifiedDate = regexp.MustCompile(`(?i)^(?:(fl\.?|floruit)\s*)?(?:(circa|ca\.?|c\.?)\s*)?(.*?)\s*(\?)?$`)
+	isoDate       = regexp.MustCompile(`^(\d{4})(?:-(\d{2})(?:-(\d{2}))?)?$`)
+	yearRange     = regexp.MustCompile(`^(\d{1,4})\s*(?:–|—|-|/|to)\s*(\d{1,4})$`)
+	year          = regexp.MustCompile(`^\d{1,4}$`)
+)
+
+// HistoricalDate is a date which may only be partially or approximately known,
+// such as "1685-03-21", "1397", "c. 1397", "1450–1455" or "fl. 1200". The
+// original text is kept alongside the interval of days it may refer to.
+type HistoricalDate struct {
+	// Original is the date as it was written.
+	Original string
+
+	// Earliest and Latest bound the days the date may refer to. They are equal
+	// for a date known to the day.
+	Earliest time.Time
+	Latest   time.Time
+
+	Precision Precision
+
+	// Uncertain is set for dates marked as circa or with a question mark.
+	Uncertain bool
+
+	// Floruit is set when the date is when the composer was known to be
+	// active, rather than the event itself.
+	Floruit bool
+}
+
+// ParseHistoricalDate parses a full or partial ISO date, a year, or a range of
+// years, each optionally qualified by "fl." and "c.". An empty string is the
+// zero date. The returned date keeps the original text even when it can't be
+// parsed.
+func ParseHistoricalDate(s string) (HistoricalDate, error) {
+	d := HistoricalDate{Original: s}
+	text := strings.TrimSpace(s)
+	if text == "" {
+		return d, nil
+	}
+
+	parts := qualifiedDate.FindStringSubmatch(text)
+	if parts == nil {
+		return HistoricalDate{Original: s}, ErrInvalidDate
+	}
+	d.Floruit = parts[1] != ""
+	d.Uncertain = parts[2] != "" || parts[4] != ""
+	body := parts[3]
+
+	switch {
+	case isoDate.MatchString(body) && !isAbbreviatedRange(body):
+		m := isoDate.FindStringSubmatch(body)
+		y, _ := strconv.Atoi(m[1])
+		d.Precision = PrecisionYear
+		d.Earliest = time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+		d.Latest = time.Date(y, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+		if m[2] != "" {
+			month, _ := strconv.Atoi(m[2])
+			if month < 1 || month > 12 {
+				return HistoricalDate{Original: s}, ErrInvalidDate
+			}
+			d.Precision = PrecisionMonth
+			d.Earliest = time.Date(y, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+			d.Latest = d.Earliest.AddDate(0, 1, -1)
+		}
+		if m[3] != "" {
+			day, _ := strconv.Atoi(m[3])
+			t := d.Earliest.AddDate(0, 0, day-1)
+			if day < 1 || t.Month() != d.Earliest.Month() {
+				return HistoricalDate{Original: s}, ErrInvalidDate
+			}
+			d.Precision = PrecisionDay
+			d.Earliest, d.Latest = t, t
+		}
+	case yearRange.MatchString(body):
+		m := yearRange.FindStringSubmatch(body)
+		start, end := m[1], m[2]
+		// Expand an abbreviated end year, e.g. "1450-55"
+		if len(end) < len(start) {
+			end = start[:len(start)-len(end)] + end
+		}
+		from, _ := strconv.Atoi(start)
+		to, _ := strconv.Atoi(end)
+		if to < from {
+			return HistoricalDate{Original: s}, ErrInvalidDate
+		}
+		d.Precision = PrecisionYear
+		d.Earliest = time.Date(from, time.January, 1, 0, 0, 0, 0, time.UTC)
+		d.Latest = time.Date(to, time.December, 31, 0, 0, 0, 0, time.UTC)
+	case year.MatchString(body):
+		y, _ := strconv.Atoi(body)
+		d.Precision = PrecisionYear
+		d.Earliest = time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+		d.Latest = time.Date(y, time.December, 31, 0, 0, 0, 0, time.UTC)
+	default:
+		return HistoricalDate{Original: s}, ErrInvalidDate
+	}
+	return d, nil
+}
+
+// MustParseHistoricalDate is like ParseHistoricalDate but ignores errors,
+// returning a date which only holds the original text.
+func MustParseHistoricalDate(s string) HistoricalDate {
+	d, _ := ParseHistoricalDate(s)
+	return d
+}
+
+// isAbbreviatedRange reports whether s, which looks like YYYY-MM, is really an
+// abbreviated range of years such as "1450-55". It is when the month can't be
+// one.
+func isAbbreviatedRange(s string) bool {
+	m := isoDate.FindStringSubmatch(s)
+	if m[2] == "" || m[3] != "" {
+		return false
+	}
+	month, _ := strconv.Atoi(m[2])
+	return month > 12
+}
+
+// IsZero reports whether the date is unset.
+func (d HistoricalDate) IsZero() bool {
+	return strings.TrimSpace(d.Original) == ""
+}
+
+// Valid reports whether the date is set and could be parsed.
+func (d HistoricalDate) Valid() bool {
+	return !d.Earliest.IsZero()
+}
+
+func (d HistoricalDate) String() string {
+	return d.Original
+}
+
+// Sortable returns the earliest day the date may refer to as YYYY-MM-DD, which
+// sorts lexically in date order. It is empty for an invalid date.
+func (d HistoricalDate) Sortable() string {
+	if !d.Valid() {
+		return ""
+	}
+	return d.Earliest.Format(sortableLayout)
+}
+
+// Compare orders dates by their earliest day, with unset or invalid dates
+// last. It returns -1, 0 or +1.
+func (d HistoricalDate) Compare(other HistoricalDate) int {
+	switch {
+	case !d.Valid() && !other.Valid():
+		return 0
+	case !d.Valid():
+		return 1
+	case !other.Valid():
+		return -1
+	default:
+		return d.Earliest.Compare(other.Earliest)
+	}
+}
+
+type historicalDateJSON struct {
+	Text      string    `json:"text"`
+	Sortable  string    `json:"sortable,omitempty"`
+	Latest    string    `json:"latest,omitempty"`
+	Precision Precision `json:"precision,omitempty"`
+	Uncertain bool      `json:"uncertain"`
+	Floruit   bool      `json:"floruit"`
+}
+
+// MarshalJSON encodes the date as an object holding both the original text
+// and its normalised form. The zero date is encoded as null.
+func (d HistoricalDate) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+
+	v := historicalDateJSON{
+		Text:      d.Original,
+		Sortable:  d.Sortable(),
+		Precision: d.Precision,
+		Uncertain: d.Uncertain,
+		Floruit:   d.Floruit,
+	}
+	if d.Valid() {
+		v.Latest = d.Latest.Format(sortableLayout)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a date from either its text or the object written by
+// MarshalJSON, from which only the text is used. Text which can't be parsed is
+// kept so that it can be reported by Validate.
+func (d *HistoricalDate) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = HistoricalDate{}
+		return nil
+	}
+
+	var text string
+	if len(data) > 0 && data[0] == '"' {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return err
+		}
+	} else {
+		v := historicalDateJSON{}
+		err := json.Unmarshal(data, &v)
+		if err != nil {
+			return err
+		}
+		text = v.Text
+	}
+
+	*d = MustParseHistoricalDate(text)
+	return nil
+}
@@ -0,0 +1,37 @@
+package composer
+
+import (
+	"time"
+)
+
+// Event types published when a composer changes.
+const (
+	EventCreated = "composer.created"
+	EventUpdated = "composer.updated"
+	EventDeleted = "composer.deleted"
+)
+
+// Event describes a change to a composer, and is the data of the CloudEvent
+// published for it. Before is nil for a created composer, and After of a
+// deleted one holds it as moved to the trash.
+type Event struct {
+	ComposerID string    `json:"composerId"`
+	Revision   uint64    `json:"revision"`
+	Action     string    `json:"action"`
+	ChangedBy  string    `json:"changedBy"`
+	ChangedAt  time.Time `json:"changedAt"`
+	Before     *Composer `json:"before"`
+	After      *Composer `json:"after"`
+}
+
+// EventType returns the type of event published for a history action.
+func EventType(action string) string {
+	switch action {
+	case ActionCreated, ActionImported:
+		return EventCreated
+	case ActionDeleted:
+		return EventDeleted
+	default:
+		return EventUpdated
+	}
+}
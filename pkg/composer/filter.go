@@ -0,0 +1,77 @@
+package composer
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filter selects composers from the library. Empty fields are ignored and the
+// remaining fields are combined with AND semantics.
+type Filter struct {
+	// Era and Nationality match case-insensitively on the whole value.
+	Era         string
+	Nationality string
+
+	// Lastname matches case-insensitively on the whole last name.
+	Lastname string
+
+	// Name matches case-insensitively anywhere in the first name, last name
+	// or full name.
+	Name string
+
+	// Query matches composers whose names contain every word of the query,
+	// as split by SearchTokens.
+	Query string
+
+	// BornAfter and DiedBefore are exclusive bounds on the life-span. An
+	// approximate date matches only if every day it may refer to is within
+	// the bound, and a composer without a parsable date never matches.
+	BornAfter  time.Time
+	DiedBefore time.Time
+
+	// Deleted selects the composers in the trash instead of the live ones.
+	Deleted bool
+}
+
+// Match reports whether c satisfies every condition of the filter.
+func (f Filter) Match(c Composer) bool {
+	if f.Deleted != c.Deleted() {
+		return false
+	}
+	if f.Era != "" && !strings.EqualFold(f.Era, c.Era) {
+		return false
+	}
+	if f.Nationality != "" && !strings.EqualFold(f.Nationality, c.Nationality) {
+		return false
+	}
+	if f.Lastname != "" && !strings.EqualFold(strings.TrimSpace(f.Lastname), strings.TrimSpace(c.Lastname)) {
+		return false
+	}
+	if f.Name != "" {
+		name := strings.ToLower(f.Name)
+		full := strings.ToLower(c.Firstname + " " + c.Lastname)
+		if !strings.Contains(full, name) {
+			return false
+		}
+	}
+	if f.Query != "" {
+		tokens := c.SearchTokens()
+		for _, token := range SearchTokens(f.Query) {
+			if _, found := slices.BinarySearch(tokens, token); !found {
+				return false
+			}
+		}
+	}
+	if !f.BornAfter.IsZero() {
+		if !c.BirthDate.Valid() || !c.BirthDate.Earliest.After(f.BornAfter) {
+			return false
+		}
+	}
+	if !f.DiedBefore.IsZero() {
+		if !c.DeathDate.Valid() || !c.DeathDate.Latest.Before(f.DiedBefore) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package composer
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"time"
+)
+
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionReverted = "reverted"
+	ActionDeleted  = "deleted"
+	ActionRestored = "restored"
+	ActionImported = "imported"
+)
+
+// HistoryEntry records a single revision of a composer.
+type HistoryEntry struct {
+	Revision  uint64    `json:"revision"`
+	Action    string    `json:"action"`
+	ChangedBy string    `json:"changedBy"`
+	ChangedAt time.Time `json:"changedAt"`
+	Changes   []Change  `json:"changes"`
+
+	// Composer is the composer as it was stored at this revision.
+	Composer Composer `json:"composer"`
+}
+
+// Change is the difference in a single field between two revisions.
+type Change struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// serverFields are managed by the server and change on every write, so they
+// are left out of diffs.
+var serverFields = []string{"id", "revision", "updatedAt"}
+
+// Diff returns the changes to the client editable fields between before and
+// after, ordered by field name. Fields are named by their JSON keys.
+func Diff(before, after Composer) []Change {
+	return DiffValues(before, after)
+}
+
+// DiffValues returns the changes between two values of any record type which,
+// like a composer, keeps its server managed fields under the JSON keys id,
+// revision and updatedAt.
+func DiffValues(before, after any) []Change {
+	from, to := fieldMap(before), fieldMap(after)
+
+	fields := []string{}
+	for field := range from {
+		fields = append(fields, field)
+	}
+	for field := range to {
+		if _, ok := from[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+
+	changes := []Change{}
+	for _, field := range fields {
+		if slices.Contains(serverFields, field) || reflect.DeepEqual(from[field], to[field]) {
+			continue
+		}
+		changes = append(changes, Change{Field: field, From: from[field], To: to[field]})
+	}
+	return changes
+}
+
+// ChangedFields returns the names of the client editable fields which differ
+// between before and after, ordered by name. Both must be of the same record
+// type.
+func ChangedFields(before, after any) []string {
+	changes := DiffValues(before, after)
+	fields := make([]string, len(changes))
+	for i, change := range changes {
+		fields[i] = change.Field
+	}
+	return fields
+}
+
+func fieldMap(v any) map[string]any {
+	fields := map[string]any{}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(b, &fields)
+	return fields
+}
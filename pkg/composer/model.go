@@ -1,11 +1,37 @@
 package composer
 
+import (
+	"time"
+
+	"github.com/jamesstocktonj1/mulib/pkg/catalogue"
+)
+
 type Composer struct {
-	ID          string `json:"id"`
-	Firstname   string `json:"firstname"`
-	Lastname    string `json:"lastname"`
-	BirthDate   string `json:"birthDate"`
-	DeathDate   string `json:"deathDate"`
-	Era         string `json:"era"`
-	Nationality string `json:"nationality"`
+	ID          string         `json:"id"`
+	Firstname   string         `json:"firstname"`
+	Lastname    string         `json:"lastname"`
+	BirthDate   HistoricalDate `json:"birthDate"`
+	DeathDate   HistoricalDate `json:"deathDate"`
+	Era         string         `json:"era"`
+	Nationality string         `json:"nationality"`
+
+	// Catalogues lists the catalogue schemes the composer's works are
+	// numbered in, such as "BWV" for Bach.
+	Catalogues []catalogue.Scheme `json:"catalogues"`
+
+	// Revision is incremented on every write to the composer and is used as
+	// its entity tag.
+	Revision uint64 `json:"revision"`
+
+	// UpdatedAt is the time of the last write to the composer.
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// DeletedAt is set when the composer has been moved to the trash. Deleted
+	// composers are kept until they are purged so that they can be restored.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// Deleted reports whether the composer is in the trash.
+func (c Composer) Deleted() bool {
+	return c.DeletedAt != nil
 }
@@ -0,0 +1,51 @@
+package composer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jamesstocktonj1/mulib/pkg/jsonpatch"
+)
+
+// Replace returns c with every client editable field taken from next. Fields
+// managed by the server, such as ID and Revision, are kept from c.
+func (c Composer) Replace(next Composer) Composer {
+	next.ID = c.ID
+	next.Revision = c.Revision
+	next.UpdatedAt = c.UpdatedAt
+	next.DeletedAt = c.DeletedAt
+	return next
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7396) to c. A member set to null
+// clears the field.
+func MergePatch(c Composer, patch []byte) (Composer, error) {
+	return applyPatch(c, patch, jsonpatch.MergePatch)
+}
+
+// JSONPatch applies a JSON Patch (RFC 6902) to c. Removing a member clears the
+// field.
+func JSONPatch(c Composer, patch []byte) (Composer, error) {
+	return applyPatch(c, patch, jsonpatch.Apply)
+}
+
+func applyPatch(c Composer, patch []byte, fn func(doc, patch []byte) ([]byte, error)) (Composer, error) {
+	doc, err := json.Marshal(c)
+	if err != nil {
+		return c, err
+	}
+	doc, err = fn(doc, patch)
+	if err != nil {
+		return c, err
+	}
+
+	patched := Composer{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&patched)
+	if err != nil {
+		return c, fmt.Errorf("%w: %v", jsonpatch.ErrInvalidPatch, err)
+	}
+	return c.Replace(patched), nil
+}
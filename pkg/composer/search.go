@@ -0,0 +1,23 @@
+package composer
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// SearchTokens splits s into the lower case words used to search for
+// composers by name. Words are runs of letters and digits, so "Saint-Saëns"
+// gives "saint" and "saëns".
+func SearchTokens(s string) []string {
+	tokens := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slices.Sort(tokens)
+	return slices.Compact(tokens)
+}
+
+// SearchTokens returns the words of the composer's names.
+func (c Composer) SearchTokens() []string {
+	return SearchTokens(c.Firstname + " " + c.Lastname)
+}
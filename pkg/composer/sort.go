@@ -0,0 +1,54 @@
+package composer
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// SortFunc returns the comparison for ordering composers by sort, which is a
+// field name optionally prefixed with '-' for descending order. Composers
+// without a usable date are ordered last either way, and ties are broken by ID
+// so that the order is stable across requests.
+func SortFunc(sort string) (func(a, b Composer) int, error) {
+	field, desc := strings.CutPrefix(sort, "-")
+
+	var cmp func(a, b Composer) int
+	switch field {
+	case "lastname":
+		cmp = func(a, b Composer) int {
+			return strings.Compare(strings.ToLower(a.Lastname), strings.ToLower(b.Lastname))
+		}
+	case "birthDate":
+		cmp = func(a, b Composer) int {
+			return compareDates(a.BirthDate, b.BirthDate, desc)
+		}
+	case "deathDate":
+		cmp = func(a, b Composer) int {
+			return compareDates(a.DeathDate, b.DeathDate, desc)
+		}
+	default:
+		return nil, ErrInvalidSort
+	}
+
+	return func(a, b Composer) int {
+		n := cmp(a, b)
+		if desc && field == "lastname" {
+			n = -n
+		}
+		if n == 0 {
+			n = strings.Compare(a.ID, b.ID)
+		}
+		return n
+	}, nil
+}
+
+// compareDates orders two dates, keeping dates which can't be placed last
+// regardless of the direction.
+func compareDates(a, b HistoricalDate, desc bool) int {
+	if !desc || !a.Valid() || !b.Valid() {
+		return a.Compare(b)
+	}
+	return b.Compare(a)
+}
@@ -0,0 +1,127 @@
+package composer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jamesstocktonj1/mulib/pkg/catalogue"
+)
+
+const (
+	MaxNameLength = 100
+)
+
+// Eras is the vocabulary of eras a composer may be assigned to.
+var Eras = []string{
+	"Medieval",
+	"Renaissance",
+	"Baroque",
+	"Classical",
+	"Romantic",
+	"Modern",
+	"Contemporary",
+}
+
+// Nationalities is the vocabulary of nationalities a composer may have.
+var Nationalities = []string{
+	"American", "Argentine", "Armenian", "Australian", "Austrian",
+	"Belgian", "Bohemian", "Brazilian", "British", "Canadian",
+	"Chinese", "Croatian", "Cuban", "Czech", "Danish",
+	"Dutch", "English", "Estonian", "Finnish", "Flemish",
+	"Franco-Flemish", "French", "Georgian", "German", "Greek",
+	"Hungarian", "Icelandic", "Irish", "Italian", "Japanese",
+	"Korean", "Latvian", "Lithuanian", "Mexican", "Norwegian",
+	"Polish", "Portuguese", "Romanian", "Russian", "Scottish",
+	"Serbian", "Slovak", "Slovenian", "Spanish", "Swedish",
+	"Swiss", "Turkish", "Ukrainian", "Venezuelan", "Welsh",
+}
+
+// FieldError describes why a single field is invalid. Field is the JSON name
+// of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a composer.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + ": " + f.Message
+	}
+	return "invalid composer: " + strings.Join(fields, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Validate checks the client editable fields of the composer, returning a
+// *ValidationError listing every invalid field. Only the last name is
+// required, as some composers are known by a single name.
+func (c Composer) Validate() error {
+	verr := &ValidationError{}
+
+	validateName(verr, "firstname", c.Firstname, false)
+	validateName(verr, "lastname", c.Lastname, true)
+
+	validateDate(verr, "birthDate", c.BirthDate)
+	validateDate(verr, "deathDate", c.DeathDate)
+	// Approximate dates may overlap, so only reject a death which is
+	// certainly before the birth
+	if c.BirthDate.Valid() && c.DeathDate.Valid() && c.DeathDate.Latest.Before(c.BirthDate.Earliest) {
+		verr.add("deathDate", "must not be before birthDate")
+	}
+
+	if c.Era != "" && !inVocabulary(Eras, c.Era) {
+		verr.add("era", "must be one of "+strings.Join(Eras, ", "))
+	}
+	if c.Nationality != "" && !inVocabulary(Nationalities, c.Nationality) {
+		verr.add("nationality", "must be a known nationality")
+	}
+
+	for i, scheme := range c.Catalogues {
+		if !slices.Contains(catalogue.Schemes, scheme) {
+			verr.add(fmt.Sprintf("catalogues[%d]", i), "must be a known catalogue scheme")
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func validateDate(verr *ValidationError, field string, value HistoricalDate) {
+	if value.IsZero() {
+		return
+	}
+	_, err := ParseHistoricalDate(value.Original)
+	if err != nil {
+		verr.add(field, `must be a date such as "1685-03-21", "1685", "c. 1397", "1450-1455" or "fl. 1200"`)
+	}
+}
+
+func validateName(verr *ValidationError, field, value string, required bool) {
+	if strings.TrimSpace(value) == "" {
+		if required {
+			verr.add(field, "is required")
+		}
+		return
+	}
+	if utf8.RuneCountInString(value) > MaxNameLength {
+		verr.add(field, fmt.Sprintf("must be at most %d characters", MaxNameLength))
+	}
+}
+
+func inVocabulary(vocabulary []string, value string) bool {
+	return slices.ContainsFunc(vocabulary, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
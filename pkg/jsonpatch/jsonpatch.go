@@ -0,0 +1,326 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrInvalidPath  = errors.New("invalid path")
+	ErrTestFailed   = errors.New("test operation failed")
+)
+
+// Operation is a single operation of a JSON Patch document.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch applies the merge patch to doc as described by RFC 7396. Members
+// of the patch set to null are removed from the document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = mergePatch(t[name], value)
+	}
+	return t
+}
+
+// Apply applies the JSON Patch document to doc as described by RFC 6902. The
+// operations are applied in order and the whole patch fails if any of them
+// does.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target any
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+	ops := []Operation{}
+	err = json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range ops {
+		target, err = apply(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func apply(doc any, op Operation) (any, error) {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: %s without value", ErrInvalidPatch, op.Op)
+		}
+		var value any
+		err := json.Unmarshal(op.Value, &value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, op.Path, value)
+		case "replace":
+			doc, _, err = remove(doc, op.Path)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, op.Path, value)
+		default:
+			current, err := get(doc, op.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("%w: %s", ErrTestFailed, op.Path)
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err := remove(doc, op.Path)
+		return doc, err
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPath, op.From)
+		}
+		doc, value, err := remove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "copy":
+		value, err := get(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, deepCopy(value))
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+	}
+
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses token as an index into an array of length n. The index n
+// itself, written as "-" or a number, is only valid when end is true.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if token == "-" && end {
+		return n, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPath, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !end) {
+		return 0, fmt.Errorf("%w: array index %q out of range", ErrInvalidPath, token)
+	}
+	return i, nil
+}
+
+func get(doc any, path string) (any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPath, path)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPath, path)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path and returns the new document, which differs from
+// doc only when path is the root or an array was grown.
+func add(doc any, path string, value any) (any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return update(doc, tokens, path, func(parent any, last string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[last] = value
+			return node, nil
+		case []any:
+			i, err := arrayIndex(last, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("%w: parent of %s is not a container", ErrInvalidPath, path)
+		}
+	})
+}
+
+// remove deletes the value at path, returning the new document and the value
+// that was removed.
+func remove(doc any, path string) (any, any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed any
+	doc, err = update(doc, tokens, path, func(parent any, last string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			value, ok := node[last]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPath, path)
+			}
+			removed = value
+			delete(node, last)
+			return node, nil
+		case []any:
+			i, err := arrayIndex(last, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: parent of %s is not a container", ErrInvalidPath, path)
+		}
+	})
+	return doc, removed, err
+}
+
+// update walks doc to the parent of the final token and replaces it with the
+// result of fn, rebuilding any arrays on the way back up.
+func update(doc any, tokens []string, path string, fn func(parent any, last string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	token := tokens[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPath, path)
+		}
+		child, err := update(child, tokens[1:], path, fn)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []any:
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], tokens[1:], path, fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("%w: %s does not exist", ErrInvalidPath, path)
+	}
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, child := range v {
+			m[key] = deepCopy(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = deepCopy(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
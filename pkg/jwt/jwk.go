@@ -0,0 +1,125 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Key types of a JSON Web Key.
+const (
+	ktyOct = "oct"
+	ktyRSA = "RSA"
+	ktyOKP = "OKP"
+
+	crvEd25519 = "Ed25519"
+
+	// minRSABits is the smallest RSA modulus accepted.
+	minRSABits = 2048
+)
+
+// Key is a verification key. Exactly one of Secret, RSA and Ed25519 is set,
+// according to the algorithm it verifies.
+type Key struct {
+	ID      string
+	Alg     string
+	Secret  []byte
+	RSA     *rsa.PublicKey
+	Ed25519 ed25519.PublicKey
+}
+
+// KeySet is the set of keys tokens may be signed with.
+type KeySet []Key
+
+// jwk is a JSON Web Key (RFC 7517) of one of the supported types.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+
+	// K is the secret of an oct key.
+	K string `json:"k"`
+
+	// N and E are the modulus and exponent of an RSA key.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// Crv and X are the curve and public key of an OKP key.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// ParseJWKS decodes a JSON Web Key Set, e.g.
+//
+//	{"keys": [{"kty": "RSA", "kid": "2024-06", "n": "...", "e": "AQAB"}]}
+//
+// Keys meant only for encryption are skipped.
+func ParseJWKS(b []byte) (KeySet, error) {
+	doc := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err := json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+
+	keys := KeySet{}
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %s", ErrInvalidKey, i, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (k jwk) key() (Key, error) {
+	key := Key{ID: k.Kid}
+
+	switch k.Kty {
+	case ktyOct:
+		secret, err := decodeSegment(k.K)
+		if err != nil || len(secret) == 0 {
+			return key, fmt.Errorf("k must be a base64url secret")
+		}
+		key.Alg, key.Secret = AlgHS256, secret
+	case ktyRSA:
+		n, errN := decodeSegment(k.N)
+		e, errE := decodeSegment(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return key, fmt.Errorf("n and e must be base64url integers")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits {
+			return key, fmt.Errorf("modulus must be at least %d bits", minRSABits)
+		}
+		key.Alg, key.RSA = AlgRS256, pub
+	case ktyOKP:
+		x, err := decodeSegment(k.X)
+		if k.Crv != crvEd25519 {
+			return key, fmt.Errorf("curve must be %s", crvEd25519)
+		} else if err != nil || len(x) != ed25519.PublicKeySize {
+			return key, fmt.Errorf("x must be a base64url Ed25519 public key")
+		}
+		key.Alg, key.Ed25519 = AlgEdDSA, ed25519.PublicKey(x)
+	default:
+		return key, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+
+	if k.Alg != "" && k.Alg != key.Alg {
+		return key, fmt.Errorf("algorithm %s does not match key type %s", k.Alg, k.Kty)
+	}
+	return key, nil
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,221 @@
+// Package jwt verifies compact JSON Web Tokens signed with HS256, RS256 or
+// EdDSA (Ed25519) against a static key set, and checks their time, issuer and
+// audience claims. Other algorithms, including "none", are refused.
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported algorithm")
+	ErrInvalidKey       = errors.New("invalid key")
+	ErrUnknownKey       = errors.New("no key for token")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token expired")
+	ErrNotYetValid      = errors.New("token not yet valid")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+)
+
+// header is the JOSE header of a token.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Audience is the aud claim, which may be a single string or a list.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Strings is a claim which may be a single space separated string, as scope
+// is by RFC 8693, or a list.
+type Strings []string
+
+func (s *Strings) UnmarshalJSON(b []byte) error {
+	var str string
+	if json.Unmarshal(b, &str) == nil {
+		*s = strings.Fields(str)
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// NumericDate is a time claim, in seconds since the epoch.
+type NumericDate struct {
+	time.Time
+}
+
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	var secs float64
+	err := json.Unmarshal(b, &secs)
+	if err != nil {
+		return err
+	}
+	d.Time = time.Unix(0, int64(secs*float64(time.Second))).UTC()
+	return nil
+}
+
+// Claims are the registered claims of a token, along with the scope and
+// roles claims used for authorization.
+type Claims struct {
+	Issuer    string       `json:"iss"`
+	Subject   string       `json:"sub"`
+	Audience  Audience     `json:"aud"`
+	ExpiresAt *NumericDate `json:"exp"`
+	NotBefore *NumericDate `json:"nbf"`
+	IssuedAt  *NumericDate `json:"iat"`
+
+	Scope Strings `json:"scope"`
+	Scp   Strings `json:"scp"`
+	Roles Strings `json:"roles"`
+}
+
+// Verifier verifies tokens signed by one of Keys. Issuer and Audience are
+// required to match when set, and Leeway allows for clock skew when checking
+// exp and nbf.
+type Verifier struct {
+	Keys     KeySet
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Verify checks the signature and claims of token at now, returning its
+// claims. A token without an exp claim is refused.
+func (v Verifier) Verify(token string, now time.Time) (Claims, error) {
+	claims := Claims{}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrMalformed
+	}
+
+	// Decode header
+	hdrBytes, err := decodeSegment(parts[0])
+	if err != nil {
+		return claims, fmt.Errorf("%w: header: %s", ErrMalformed, err)
+	}
+	hdr := header{}
+	err = json.Unmarshal(hdrBytes, &hdr)
+	if err != nil {
+		return claims, fmt.Errorf("%w: header: %s", ErrMalformed, err)
+	}
+	if hdr.Alg != AlgHS256 && hdr.Alg != AlgRS256 && hdr.Alg != AlgEdDSA {
+		return claims, fmt.Errorf("%w: %q", ErrUnsupportedAlg, hdr.Alg)
+	}
+
+	// Verify signature
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("%w: signature: %s", ErrMalformed, err)
+	}
+	err = v.verifySignature(hdr, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return claims, err
+	}
+
+	// Decode claims
+	claimsBytes, err := decodeSegment(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("%w: claims: %s", ErrMalformed, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(claimsBytes))
+	err = dec.Decode(&claims)
+	if err != nil {
+		return claims, fmt.Errorf("%w: claims: %s", ErrMalformed, err)
+	}
+
+	// Check claims
+	if claims.ExpiresAt == nil {
+		return claims, fmt.Errorf("%w: no exp claim", ErrExpired)
+	} else if !now.Before(claims.ExpiresAt.Add(v.Leeway)) {
+		return claims, ErrExpired
+	}
+	if claims.NotBefore != nil && now.Add(v.Leeway).Before(claims.NotBefore.Time) {
+		return claims, ErrNotYetValid
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return claims, ErrInvalidIssuer
+	}
+	if v.Audience != "" && !slices.Contains(claims.Audience, v.Audience) {
+		return claims, ErrInvalidAudience
+	}
+	return claims, nil
+}
+
+// verifySignature checks sig against the keys for the header's algorithm,
+// narrowed to the key it names if it has a kid.
+func (v Verifier) verifySignature(hdr header, signed, sig []byte) error {
+	found := false
+	for _, key := range v.Keys {
+		if key.Alg != hdr.Alg || (hdr.Kid != "" && key.ID != hdr.Kid) {
+			continue
+		}
+		found = true
+
+		if verifyWith(key, signed, sig) {
+			return nil
+		}
+	}
+	if !found {
+		return ErrUnknownKey
+	}
+	return ErrInvalidSignature
+}
+
+func verifyWith(key Key, signed, sig []byte) bool {
+	switch key.Alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case AlgRS256:
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.RSA, crypto.SHA256, sum[:], sig) == nil
+	case AlgEdDSA:
+		return ed25519.Verify(key.Ed25519, signed, sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,80 @@
+// Package problem implements the problem details error model of RFC 7807,
+// extended with a stable error code and the id of the failed request.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	ContentType = "application/problem+json"
+
+	// typePrefix prefixes the error code to form the problem type URI.
+	typePrefix = "urn:mulib:problem:"
+)
+
+// Code is a stable, machine readable identifier of an error. Clients should
+// branch on the code rather than the title or detail.
+type Code string
+
+const (
+	CodeBadRequest           Code = "bad-request"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeDecodeFailed         Code = "decode-failed"
+	CodeValidationFailed     Code = "validation-failed"
+	CodeNotFound             Code = "not-found"
+	CodeMethodNotAllowed     Code = "method-not-allowed"
+	CodeConflict             Code = "conflict"
+	CodePreconditionFailed   Code = "precondition-failed"
+	CodeUnsupportedMediaType Code = "unsupported-media-type"
+	CodeStoreUnavailable     Code = "store-unavailable"
+	CodeStoreAccessDenied    Code = "store-access-denied"
+	CodeStoreError           Code = "store-error"
+	CodeInternal             Code = "internal-error"
+)
+
+// Problem is a problem details object. It implements error so that it can be
+// returned up the stack and written by the handler.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+
+	// Errors holds the individual failures, such as invalid fields, when the
+	// problem has more than one cause.
+	Errors any `json:"errors,omitempty"`
+}
+
+// New returns a problem with the given status, code and detail.
+func New(status int, code Code, detail string) *Problem {
+	return &Problem{
+		Type:   typePrefix + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return string(p.Code)
+	}
+	return string(p.Code) + ": " + p.Detail
+}
+
+// Write writes the problem as the response with its status.
+func (p *Problem) Write(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
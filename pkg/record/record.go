@@ -0,0 +1,72 @@
+// Package record holds what every record served by the component's generic
+// resource has in common: the fields managed by the server, the history kept
+// of its revisions and the events published for them.
+package record
+
+import (
+	"time"
+
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+)
+
+// Meta holds the fields managed by the server which every record has.
+type Meta struct {
+	ID string `json:"id"`
+
+	// Revision is incremented on every write to the record and is used as
+	// its entity tag.
+	Revision uint64 `json:"revision"`
+
+	// UpdatedAt is the time of the last write to the record.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Metadata returns the server managed fields of the record.
+func (m *Meta) Metadata() *Meta {
+	return m
+}
+
+// HistoryEntry records a single revision of a record, with the same actions
+// as the history of a composer.
+type HistoryEntry[T any] struct {
+	Revision  uint64            `json:"revision"`
+	Action    string            `json:"action"`
+	ChangedBy string            `json:"changedBy"`
+	ChangedAt time.Time         `json:"changedAt"`
+	Changes   []composer.Change `json:"changes"`
+
+	// Record is the record as it was stored at this revision.
+	Record T `json:"record"`
+}
+
+// Event describes a change to a record, and is the data of the CloudEvent
+// published for it. Before is nil for a created record, and After is nil for
+// a deleted one.
+type Event[T any] struct {
+	ID        string    `json:"id"`
+	Revision  uint64    `json:"revision"`
+	Action    string    `json:"action"`
+	ChangedBy string    `json:"changedBy"`
+	ChangedAt time.Time `json:"changedAt"`
+	Before    *T        `json:"before"`
+	After     *T        `json:"after"`
+}
+
+// EventType returns the type of event published for a history action on a
+// record of the named kind, e.g. "work.updated".
+func EventType(kind, action string) string {
+	switch action {
+	case composer.ActionCreated, composer.ActionImported:
+		return kind + ".created"
+	case composer.ActionDeleted:
+		return kind + ".deleted"
+	default:
+		return kind + ".updated"
+	}
+}
+
+// EventTypes returns every event type published for records of the named
+// kind.
+func EventTypes(kind string) []string {
+	return []string{kind + ".created", kind + ".updated", kind + ".deleted"}
+}
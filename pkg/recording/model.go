@@ -0,0 +1,73 @@
+// Package recording models the recordings of works and the performers and
+// ensembles who made them.
+package recording
+
+import (
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/record"
+)
+
+type Performer struct {
+	record.Meta
+	Name string `json:"name"`
+
+	// Instruments lists what the performer plays or sings, such as "piano"
+	// or "soprano".
+	Instruments []string `json:"instruments"`
+}
+
+type Ensemble struct {
+	record.Meta
+	Name string `json:"name"`
+
+	// Kind is the type of ensemble, such as "orchestra" or "choir".
+	Kind string `json:"kind"`
+
+	// Location is where the ensemble is based.
+	Location string `json:"location"`
+}
+
+// Role is the part a performer or ensemble played in a recording.
+type Role string
+
+const (
+	RoleConductor Role = "conductor"
+	RoleSoloist   Role = "soloist"
+	RoleOrchestra Role = "orchestra"
+	RoleChoir     Role = "choir"
+	RoleEnsemble  Role = "ensemble"
+)
+
+// PerformerRoles are taken by performers and EnsembleRoles by ensembles.
+var (
+	PerformerRoles = []Role{RoleConductor, RoleSoloist}
+	EnsembleRoles  = []Role{RoleOrchestra, RoleChoir, RoleEnsemble}
+)
+
+// Credit links a recording to a performer or an ensemble by their role. Only
+// the id matching the role is set.
+type Credit struct {
+	Role        Role   `json:"role"`
+	PerformerID string `json:"performerId,omitempty"`
+	EnsembleID  string `json:"ensembleId,omitempty"`
+}
+
+type Recording struct {
+	record.Meta
+	Title string `json:"title"`
+	Label string `json:"label"`
+
+	// CatalogueNumber is the label's catalogue number of the release.
+	CatalogueNumber string `json:"catalogueNumber"`
+
+	Recorded composer.HistoricalDate `json:"recordingDate"`
+	Venue    string                  `json:"venue"`
+
+	// ISRC identifies the recording and EAN the product it was released on.
+	ISRC string `json:"isrc"`
+	EAN  string `json:"ean"`
+
+	// WorkIDs links the recording to the works performed on it.
+	WorkIDs []string `json:"workIds"`
+	Credits []Credit `json:"credits"`
+}
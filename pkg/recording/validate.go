@@ -0,0 +1,149 @@
+package recording
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+)
+
+const (
+	MaxFieldLength = 200
+)
+
+var (
+	// isrcPattern matches an ISRC with its hyphens removed: country, owner,
+	// year and designation code.
+	isrcPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+	eanPattern  = regexp.MustCompile(`^[0-9]{13}$`)
+)
+
+// ValidationError lists every invalid field of a record.
+type ValidationError struct {
+	Fields []composer.FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + ": " + f.Message
+	}
+	return "invalid record: " + strings.Join(fields, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, composer.FieldError{Field: field, Message: message})
+}
+
+func (e *ValidationError) err() error {
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
+}
+
+// Validate checks the client editable fields of the performer, returning a
+// *ValidationError listing every invalid field.
+func (p Performer) Validate() error {
+	verr := &ValidationError{}
+	validateText(verr, "name", p.Name, true)
+	for i, instrument := range p.Instruments {
+		validateText(verr, fmt.Sprintf("instruments[%d]", i), instrument, true)
+	}
+	return verr.err()
+}
+
+// Validate checks the client editable fields of the ensemble, returning a
+// *ValidationError listing every invalid field.
+func (e Ensemble) Validate() error {
+	verr := &ValidationError{}
+	validateText(verr, "name", e.Name, true)
+	validateText(verr, "kind", e.Kind, false)
+	validateText(verr, "location", e.Location, false)
+	return verr.err()
+}
+
+// Validate checks the client editable fields of the recording, returning a
+// *ValidationError listing every invalid field. Whether the linked works,
+// performers and ensembles exist is left to the caller.
+func (r Recording) Validate() error {
+	verr := &ValidationError{}
+
+	validateText(verr, "title", r.Title, true)
+	validateText(verr, "label", r.Label, false)
+	validateText(verr, "catalogueNumber", r.CatalogueNumber, false)
+	validateText(verr, "venue", r.Venue, false)
+	if !r.Recorded.IsZero() && !r.Recorded.Valid() {
+		verr.add("recordingDate", `must be a date such as "1955-06-10", "1955-06" or "c. 1955"`)
+	}
+	if r.ISRC != "" && !isrcPattern.MatchString(NormaliseISRC(r.ISRC)) {
+		verr.add("isrc", `must be an ISRC such as "USRC17607839"`)
+	}
+	if r.EAN != "" && !validEAN(r.EAN) {
+		verr.add("ean", "must be a 13 digit EAN with a valid check digit")
+	}
+
+	for i, id := range r.WorkIDs {
+		if uuid.Validate(id) != nil {
+			verr.add(fmt.Sprintf("workIds[%d]", i), "must be a work id")
+		} else if slices.Index(r.WorkIDs, id) < i {
+			verr.add(fmt.Sprintf("workIds[%d]", i), "must not repeat a work")
+		}
+	}
+
+	for i, credit := range r.Credits {
+		field := fmt.Sprintf("credits[%d]", i)
+		switch {
+		case slices.Contains(PerformerRoles, credit.Role):
+			if uuid.Validate(credit.PerformerID) != nil || credit.EnsembleID != "" {
+				verr.add(field, "must have a performerId and no ensembleId for role "+string(credit.Role))
+			}
+		case slices.Contains(EnsembleRoles, credit.Role):
+			if uuid.Validate(credit.EnsembleID) != nil || credit.PerformerID != "" {
+				verr.add(field, "must have an ensembleId and no performerId for role "+string(credit.Role))
+			}
+		default:
+			verr.add(field+".role", "must be a known role")
+		}
+	}
+
+	return verr.err()
+}
+
+// NormaliseISRC returns the ISRC in upper case without hyphens or spaces.
+func NormaliseISRC(isrc string) string {
+	isrc = strings.ToUpper(isrc)
+	return strings.NewReplacer("-", "", " ", "").Replace(isrc)
+}
+
+// validEAN reports whether ean is an EAN-13 with a valid check digit.
+func validEAN(ean string) bool {
+	if !eanPattern.MatchString(ean) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 12; i++ {
+		digit := int(ean[i] - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10-sum%10)%10 == int(ean[12]-'0')
+}
+
+func validateText(verr *ValidationError, field, value string, required bool) {
+	if strings.TrimSpace(value) == "" {
+		if required {
+			verr.add(field, "is required")
+		}
+		return
+	}
+	if utf8.RuneCountInString(value) > MaxFieldLength {
+		verr.add(field, fmt.Sprintf("must be at most %d characters", MaxFieldLength))
+	}
+}
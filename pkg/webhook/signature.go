@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every delivery is signed with the subscription's secret. The signature
+// header holds the time of signing and the hex HMAC-SHA256 of
+// "<unix seconds>.<body>", e.g. "t=1718000000,v1=5257a8...", so that a
+// receiver can reject both forged and replayed deliveries.
+const (
+	SignatureHeader = "X-Mulib-Signature"
+	DeliveryHeader  = "X-Mulib-Delivery"
+	EventHeader     = "X-Mulib-Event"
+
+	signatureVersion = "v1"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signature outside tolerance")
+)
+
+// Sign returns the signature header value for body signed at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + "," + signatureVersion + "=" + mac(secret, ts, body)
+}
+
+// Verify checks that header is a valid signature of body made with secret
+// no more than tolerance from now.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			ts = value
+		case signatureVersion:
+			sig = value
+		}
+	}
+	if ts == "" || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return ErrExpiredSignature
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts + "."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
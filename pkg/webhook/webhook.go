@@ -0,0 +1,201 @@
+// Package webhook describes subscriptions to library events delivered as
+// signed HTTP callbacks, and the deliveries made to them.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/record"
+)
+
+const (
+	// MinSecretLength is the shortest signing secret a subscription may have.
+	MinSecretLength = 16
+)
+
+// EventTypes lists the event types a subscription may filter on.
+var EventTypes = slices.Concat(
+	[]string{composer.EventCreated, composer.EventUpdated, composer.EventDeleted},
+	record.EventTypes("work"),
+	record.EventTypes("performer"),
+	record.EventTypes("ensemble"),
+	record.EventTypes("recording"),
+)
+
+// Subscription sends the events matching Events to URL. An empty Events
+// matches every event. Secret signs each delivery and is never returned once
+// the subscription has been created.
+type Subscription struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+
+	// Disabled stops deliveries to the subscription without deleting it.
+	Disabled bool `json:"disabled"`
+
+	Revision  uint64    `json:"revision"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Replace returns s with every client editable field taken from next. The
+// secret is only replaced when next has one, so that an update needn't repeat
+// it.
+func (s Subscription) Replace(next Subscription) Subscription {
+	s.URL = next.URL
+	s.Events = next.Events
+	s.Disabled = next.Disabled
+	if next.Secret != "" {
+		s.Secret = next.Secret
+	}
+	return s
+}
+
+// Redacted returns s without its secret.
+func (s Subscription) Redacted() Subscription {
+	s.Secret = ""
+	return s
+}
+
+// Matches reports whether events of the given type are sent to s.
+func (s Subscription) Matches(eventType string) bool {
+	return !s.Disabled && (len(s.Events) == 0 || slices.Contains(s.Events, eventType))
+}
+
+// ValidationError lists every invalid field of a subscription.
+type ValidationError struct {
+	Fields []composer.FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + ": " + f.Message
+	}
+	return "invalid subscription: " + strings.Join(fields, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, composer.FieldError{Field: field, Message: message})
+}
+
+// Validate checks the client editable fields of the subscription, returning a
+// *ValidationError listing every invalid field.
+func (s Subscription) Validate() error {
+	verr := &ValidationError{}
+
+	u, err := url.Parse(s.URL)
+	if s.URL == "" {
+		verr.add("url", "is required")
+	} else if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.add("url", "must be an absolute http or https URL")
+	} else if u.User != nil {
+		verr.add("url", "must not contain credentials")
+	} else if !publicHost(u.Hostname()) {
+		verr.add("url", "must not be a loopback, private or link-local host")
+	}
+
+	for i, eventType := range s.Events {
+		field := fmt.Sprintf("events[%d]", i)
+		if !slices.Contains(EventTypes, eventType) {
+			verr.add(field, "must be one of "+strings.Join(EventTypes, ", "))
+		} else if slices.Index(s.Events, eventType) != i {
+			verr.add(field, "is repeated")
+		}
+	}
+
+	if len(s.Secret) < MinSecretLength {
+		verr.add("secret", fmt.Sprintf("must be at least %d characters", MinSecretLength))
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// publicHost reports whether host may be the target of a delivery, so that a
+// subscription can't be used to reach services on the component's own
+// network. Addresses which are loopback, private, link-local, multicast or
+// unspecified are refused, as are the localhost names and hosts which are
+// numbers, which resolvers may read as addresses in other notations. Names are
+// not resolved, so a public name pointing at a private address isn't caught.
+func publicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	host, _, _ = strings.Cut(host, "%")
+	if ip := net.ParseIP(host); ip != nil {
+		return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+			!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+			!ip.IsMulticast() && !ip.IsUnspecified()
+	}
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	labels := strings.Split(host, ".")
+	last := labels[len(labels)-1]
+	if strings.HasPrefix(last, "0x") {
+		return false
+	}
+	_, err := strconv.ParseUint(last, 10, 64)
+	return err != nil
+}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Delivery is one event sent to a subscription, retried until it is delivered
+// or has failed MaxAttempts times, when it becomes a dead letter. Payload is
+// the exact body sent, so that every attempt carries the same signature input.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionId"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// Attempt is one attempt at a delivery, as kept in the delivery log of a
+// subscription.
+type Attempt struct {
+	DeliveryID  string    `json:"deliveryId"`
+	EventID     string    `json:"eventId"`
+	EventType   string    `json:"eventType"`
+	Attempt     int       `json:"attempt"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Status      string    `json:"status"`
+}
+
+// Succeeded reports whether the status code acknowledges a delivery.
+func Succeeded(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+// Backoff returns how long to wait after the given failed attempt, counting
+// from one, before trying again. The wait doubles from base with every attempt
+// up to limit.
+func Backoff(attempt int, base, limit time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
@@ -0,0 +1,40 @@
+package work
+
+import (
+	"strings"
+)
+
+// CSVColumns are the columns of a work written as CSV. Columns holding lists
+// separate their values with semicolons.
+var CSVColumns = []string{
+	"id",
+	"title",
+	"key",
+	"genre",
+	"yearComposed",
+	"instrumentation",
+	"duration",
+	"opus",
+	"catalogueNumbers",
+	"composerIds",
+}
+
+// CSVRecord returns the work as a CSV record in the order of CSVColumns.
+func (w Work) CSVRecord() []string {
+	numbers := make([]string, len(w.CatalogueNumbers))
+	for i, n := range w.CatalogueNumbers {
+		numbers[i] = n.String()
+	}
+	return []string{
+		w.ID,
+		w.Title,
+		w.Key,
+		w.Genre,
+		w.Composed.String(),
+		strings.Join(w.Instrumentation, ";"),
+		w.Duration,
+		w.Opus,
+		strings.Join(numbers, ";"),
+		strings.Join(w.ComposerIDs, ";"),
+	}
+}
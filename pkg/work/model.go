@@ -0,0 +1,71 @@
+// Package work models the musical works, or compositions, of the library.
+package work
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/jamesstocktonj1/mulib/pkg/catalogue"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+	"github.com/jamesstocktonj1/mulib/pkg/record"
+)
+
+type Work struct {
+	record.Meta
+	Title string `json:"title"`
+
+	// Key is the tonality of the work, such as "D minor" or "B-flat major".
+	Key   string `json:"key"`
+	Genre string `json:"genre"`
+
+	// Composed is when the work was written, which is often only known to the
+	// year or approximately.
+	Composed composer.HistoricalDate `json:"yearComposed"`
+
+	// Instrumentation lists the instruments or voices the work is scored for.
+	Instrumentation []string `json:"instrumentation"`
+
+	// Duration is the typical performance time as an ISO 8601 duration, such
+	// as "PT21M30S".
+	Duration string `json:"duration"`
+	Opus     string `json:"opus"`
+
+	// CatalogueNumbers identifies the work in the thematic catalogues of its
+	// composers, such as "BWV 1007".
+	CatalogueNumbers []catalogue.Number `json:"catalogueNumbers"`
+
+	// ComposerIDs links the work to the composers who wrote it.
+	ComposerIDs []string `json:"composerIds"`
+}
+
+// Replace returns w with every client editable field taken from next. Fields
+// managed by the server, such as ID and Revision, are kept from w.
+func (w Work) Replace(next Work) Work {
+	next.Meta = w.Meta
+	return next
+}
+
+// CompareCatalogue orders works by their lowest catalogue number, with works
+// without one last, and then by title. It returns -1, 0 or +1.
+func CompareCatalogue(a, b Work) int {
+	aNum, aOK := a.lowestNumber()
+	bNum, bOK := b.lowestNumber()
+	switch {
+	case aOK && bOK:
+		if c := catalogue.Compare(aNum, bNum); c != 0 {
+			return c
+		}
+	case aOK:
+		return -1
+	case bOK:
+		return 1
+	}
+	return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+}
+
+func (w Work) lowestNumber() (catalogue.Number, bool) {
+	if len(w.CatalogueNumbers) == 0 {
+		return catalogue.Number{}, false
+	}
+	return slices.MinFunc(w.CatalogueNumbers, catalogue.Compare), true
+}
@@ -0,0 +1,99 @@
+package work
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jamesstocktonj1/mulib/pkg/catalogue"
+	"github.com/jamesstocktonj1/mulib/pkg/composer"
+)
+
+const (
+	MaxTitleLength = 200
+	MaxFieldLength = 100
+)
+
+var (
+	// keyPattern matches a tonality written as a note name, an optional
+	// accidental and the mode, e.g. "C major", "F-sharp minor" or "B♭ major".
+	keyPattern = regexp.MustCompile(`(?i)^[A-G](?:-flat|-sharp|♭|♯|b|#)? (?:major|minor)$`)
+
+	// durationPattern matches the time part of an ISO 8601 duration.
+	durationPattern = regexp.MustCompile(`^PT(?:\d+H)?(?:\d+M)?(?:\d+S)?$`)
+)
+
+// ValidationError lists every invalid field of a work.
+type ValidationError struct {
+	Fields []composer.FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + ": " + f.Message
+	}
+	return "invalid work: " + strings.Join(fields, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, composer.FieldError{Field: field, Message: message})
+}
+
+// Validate checks the client editable fields of the work, returning a
+// *ValidationError listing every invalid field. A work needs a title and at
+// least one composer. Whether the composers exist is left to the caller.
+func (w Work) Validate() error {
+	verr := &ValidationError{}
+
+	if strings.TrimSpace(w.Title) == "" {
+		verr.add("title", "is required")
+	} else if utf8.RuneCountInString(w.Title) > MaxTitleLength {
+		verr.add("title", fmt.Sprintf("must be at most %d characters", MaxTitleLength))
+	}
+	if w.Key != "" && !keyPattern.MatchString(w.Key) {
+		verr.add("key", `must be a key such as "C major" or "F-sharp minor"`)
+	}
+	if utf8.RuneCountInString(w.Genre) > MaxFieldLength {
+		verr.add("genre", fmt.Sprintf("must be at most %d characters", MaxFieldLength))
+	}
+	if utf8.RuneCountInString(w.Opus) > MaxFieldLength {
+		verr.add("opus", fmt.Sprintf("must be at most %d characters", MaxFieldLength))
+	}
+	if !w.Composed.IsZero() && !w.Composed.Valid() {
+		verr.add("yearComposed", `must be a date such as "1721", "c. 1720" or "1720-1723"`)
+	}
+	if w.Duration != "" && (w.Duration == "PT" || !durationPattern.MatchString(w.Duration)) {
+		verr.add("duration", `must be an ISO 8601 duration such as "PT21M30S"`)
+	}
+	for i, instrument := range w.Instrumentation {
+		if strings.TrimSpace(instrument) == "" {
+			verr.add(fmt.Sprintf("instrumentation[%d]", i), "must not be empty")
+		}
+	}
+
+	for i, num := range w.CatalogueNumbers {
+		if slices.IndexFunc(w.CatalogueNumbers, func(n catalogue.Number) bool { return n == num }) < i {
+			verr.add(fmt.Sprintf("catalogueNumbers[%d]", i), "must not repeat a catalogue number")
+		}
+	}
+
+	if len(w.ComposerIDs) == 0 {
+		verr.add("composerIds", "must list at least one composer")
+	}
+	for i, id := range w.ComposerIDs {
+		if uuid.Validate(id) != nil {
+			verr.add(fmt.Sprintf("composerIds[%d]", i), "must be a composer id")
+		} else if slices.Index(w.ComposerIDs, id) < i {
+			verr.add(fmt.Sprintf("composerIds[%d]", i), "must not repeat a composer")
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Command webhook-receiver is a local stand-in for a webhook subscriber. It
+// verifies the signature of every delivery and logs the event, and can fail
+// the first deliveries it receives to exercise retries and dead letters.
+//
+//	go run ./tools/webhook-receiver -addr :9090 -secret <subscription secret> -fail 2
+package main
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jamesstocktonj1/mulib/pkg/cloudevents"
+	"github.com/jamesstocktonj1/mulib/pkg/webhook"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	secret := flag.String("secret", "", "signing secret of the subscription")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "largest accepted age of a signature")
+	fail := flag.Int("fail", 0, "number of deliveries to fail before accepting any")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	var mu sync.Mutex
+	failed := 0
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("Error reading body", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Verify signature
+		err = webhook.Verify(*secret, r.Header.Get(webhook.SignatureHeader), body, *tolerance, time.Now())
+		if err != nil {
+			logger.Error("Rejected delivery", "delivery", r.Header.Get(webhook.DeliveryHeader), "error", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// Fail on request
+		mu.Lock()
+		failing := failed < *fail
+		if failing {
+			failed++
+		}
+		mu.Unlock()
+		if failing {
+			logger.Info("Failing delivery", "delivery", r.Header.Get(webhook.DeliveryHeader))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		// Log event
+		event, err := cloudevents.ParseStructured(body)
+		if err != nil {
+			logger.Error("Invalid event", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		logger.Info("Received event",
+			"delivery", r.Header.Get(webhook.DeliveryHeader),
+			"type", event.Type,
+			"subject", event.Subject,
+			"data", string(event.Data))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	logger.Info("Listening", "addr", *addr)
+	err := http.ListenAndServe(*addr, nil)
+	if err != nil {
+		logger.Error("Error serving", "error", err)
+		os.Exit(1)
+	}
+}